@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/czerwonk/atlas_exporter/atlas"
+	"github.com/czerwonk/atlas_exporter/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Prefix is the path all endpoints of the admin API are served under
+const Prefix = "/api/v1/measurements"
+
+// MeasurementState is the state of a measurement as returned by the admin API
+type MeasurementState struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Paused bool   `json:"paused"`
+	atlas.MeasurementStatus
+}
+
+type addRequest struct {
+	ID     json.Number `json:"id"`
+	APIKey string      `json:"api_key"`
+}
+
+// API serves endpoints to list, add, remove and pause measurements at runtime
+type API struct {
+	registry *atlas.Registry
+	strategy func() atlas.Strategy
+	token    func() config.Secret
+}
+
+// NewAPI returns an admin API managing the measurements of the registry. Requests have to provide
+// the token returned by token as bearer token.
+func NewAPI(registry *atlas.Registry, strategy func() atlas.Strategy, token func() config.Secret) *API {
+	return &API{
+		registry: registry,
+		strategy: strategy,
+		token:    token,
+	}
+}
+
+// Register registers the endpoints at mux
+func (a *API) Register(mux *http.ServeMux) {
+	mux.Handle("GET "+Prefix, a.auth(a.list))
+	mux.Handle("POST "+Prefix, a.auth(a.add))
+	mux.Handle("GET "+Prefix+"/{id}", a.auth(a.get))
+	mux.Handle("DELETE "+Prefix+"/{id}", a.auth(a.remove))
+	mux.Handle("POST "+Prefix+"/{id}/pause", a.auth(a.pause))
+	mux.Handle("POST "+Prefix+"/{id}/resume", a.auth(a.resume))
+}
+
+func (a *API) auth(f http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := a.token()
+		given, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !found || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+
+		f(w, r)
+	})
+}
+
+func (a *API) list(w http.ResponseWriter, r *http.Request) {
+	ms := a.registry.Measurements()
+
+	res := make([]MeasurementState, 0, len(ms))
+	for _, m := range ms {
+		res = append(res, a.state(m.ID))
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (a *API) get(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, found := a.registry.Get(id); !found {
+		writeError(w, http.StatusNotFound, errors.New("measurement not found"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.state(id))
+}
+
+func (a *API) add(w http.ResponseWriter, r *http.Request) {
+	req := addRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+
+	id := req.ID.String()
+	if i, err := strconv.Atoi(id); err != nil || i <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("id must be a positive number"))
+		return
+	}
+
+	if !a.registry.Add(config.Measurement{ID: id, APIKey: config.Secret(req.APIKey)}) {
+		writeError(w, http.StatusConflict, errors.New("measurement already exists"))
+		return
+	}
+
+	log.Infof("Measurement #%s added via admin API", id)
+	writeJSON(w, http.StatusCreated, a.state(id))
+}
+
+func (a *API) remove(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !a.registry.Remove(id) {
+		writeError(w, http.StatusNotFound, errors.New("measurement not found"))
+		return
+	}
+
+	log.Infof("Measurement #%s removed via admin API", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) pause(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !a.registry.Pause(id) {
+		writeError(w, http.StatusNotFound, errors.New("measurement not found"))
+		return
+	}
+
+	log.Infof("Measurement #%s paused via admin API", id)
+	writeJSON(w, http.StatusOK, a.state(id))
+}
+
+func (a *API) resume(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !a.registry.Resume(id) {
+		writeError(w, http.StatusNotFound, errors.New("measurement not found"))
+		return
+	}
+
+	log.Infof("Measurement #%s resumed via admin API", id)
+	writeJSON(w, http.StatusOK, a.state(id))
+}
+
+func (a *API) state(id string) MeasurementState {
+	return State(a.registry, a.strategy(), id)
+}
+
+// State returns the state of a measurement of the registry. The runtime state is only set for strategies
+// implementing atlas.StatusReporter.
+func State(registry *atlas.Registry, s atlas.Strategy, id string) MeasurementState {
+	source, _ := registry.Source(id)
+	st := MeasurementState{
+		ID:     id,
+		Source: source,
+		Paused: registry.IsPaused(id),
+	}
+
+	if sr, ok := s.(atlas.StatusReporter); ok {
+		st.MeasurementStatus = sr.MeasurementStatus(id)
+	}
+
+	return st
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("could not write admin API response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
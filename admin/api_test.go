@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/czerwonk/atlas_exporter/atlas"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/exporter"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStrategy struct{}
+
+func (fakeStrategy) MeasurementResults(ctx context.Context, ids []string) ([]*exporter.Measurement, error) {
+	return nil, nil
+}
+
+func (fakeStrategy) IsHealthy() bool {
+	return true
+}
+
+func (fakeStrategy) MeasurementStatus(id string) atlas.MeasurementStatus {
+	return atlas.MeasurementStatus{Connected: true, Probes: 3}
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *atlas.Registry) {
+	t.Helper()
+
+	cfg := &config.Config{Measurements: []config.Measurement{{ID: "1001"}}}
+	r := atlas.NewRegistry(cfg)
+
+	mux := http.NewServeMux()
+	NewAPI(r, func() atlas.Strategy { return fakeStrategy{} }, func() config.Secret { return "secret" }).Register(mux)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv, r
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, token, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	return resp
+}
+
+func TestAuth(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	require.Equal(t, http.StatusUnauthorized, do(t, srv, http.MethodGet, Prefix, "", "").StatusCode)
+	require.Equal(t, http.StatusUnauthorized, do(t, srv, http.MethodGet, Prefix, "wrong", "").StatusCode)
+	require.Equal(t, http.StatusOK, do(t, srv, http.MethodGet, Prefix, "secret", "").StatusCode)
+}
+
+func TestManageMeasurements(t *testing.T) {
+	srv, r := newTestServer(t)
+
+	resp := do(t, srv, http.MethodPost, Prefix, "secret", `{"id": 1002}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, []string{"1001", "1002"}, r.IDs())
+
+	require.Equal(t, http.StatusConflict, do(t, srv, http.MethodPost, Prefix, "secret", `{"id": "1001"}`).StatusCode)
+	require.Equal(t, http.StatusBadRequest, do(t, srv, http.MethodPost, Prefix, "secret", `{"id": "abc"}`).StatusCode)
+
+	resp = do(t, srv, http.MethodPost, Prefix+"/1001/pause", "secret", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.True(t, r.IsPaused("1001"))
+	require.Len(t, r.Active(), 1)
+
+	resp = do(t, srv, http.MethodGet, Prefix, "secret", "")
+	states := []MeasurementState{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&states))
+	require.Len(t, states, 2)
+	require.Equal(t, "config", states[0].Source)
+	require.True(t, states[0].Paused)
+	require.Equal(t, "admin", states[1].Source)
+	require.True(t, states[1].Connected)
+	require.Equal(t, 3, states[1].Probes)
+
+	require.Equal(t, http.StatusOK, do(t, srv, http.MethodPost, Prefix+"/1001/resume", "secret", "").StatusCode)
+	require.False(t, r.IsPaused("1001"))
+
+	// measurements of the config can be removed as well
+	require.Equal(t, http.StatusNoContent, do(t, srv, http.MethodDelete, Prefix+"/1001", "secret", "").StatusCode)
+	require.Equal(t, []string{"1002"}, r.IDs())
+	require.Equal(t, http.StatusNotFound, do(t, srv, http.MethodGet, Prefix+"/1001", "secret", "").StatusCode)
+	require.Equal(t, http.StatusNotFound, do(t, srv, http.MethodDelete, Prefix+"/1001", "secret", "").StatusCode)
+}
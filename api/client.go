@@ -0,0 +1,291 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DNS-OARC/ripeatlas"
+	"github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/DNS-OARC/ripeatlas/request"
+	"github.com/czerwonk/atlas_exporter/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Client accesses the RIPE Atlas REST API at a configurable base URL.
+// It implements `ripeatlas.Atlaser` for measurement results.
+// Requests failing with 429, 5xx or a network error are retried with exponential backoff
+// and limited by a token bucket shared by all copies of the client.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	key     config.Secret
+	ctx     context.Context
+	retries uint
+	backoff time.Duration
+	limiter *limiter
+}
+
+// StatusError is returned for requests answered with an unexpected HTTP status code
+type StatusError struct {
+	StatusCode int
+	Path       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d requesting %s", e.StatusCode, e.Path)
+}
+
+// NewClient returns a client for the API configured in cfg
+func NewClient(cfg *config.Config) (*Client, error) {
+	t, err := NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(cfg.Atlas.APIURL, "/"),
+		http:    &http.Client{Transport: t, Timeout: cfg.Atlas.Timeout},
+		key:     cfg.Atlas.APIKey,
+		ctx:     context.Background(),
+		retries: cfg.Atlas.Retries,
+		backoff: defaultBackoff,
+		limiter: newLimiter(cfg.Atlas.RateLimit, cfg.Atlas.RateBurst),
+	}, nil
+}
+
+// WithContext returns a client whose requests (including retries and waiting for the rate limit)
+// are canceled when ctx is done
+func (c *Client) WithContext(ctx context.Context) *Client {
+	cl := *c
+	cl.ctx = ctx
+	return &cl
+}
+
+// WithKey returns a client sending the given API key instead of the configured one (if not empty)
+func (c *Client) WithKey(key config.Secret) *Client {
+	if key == "" || key == c.key {
+		return c
+	}
+
+	cl := *c
+	cl.key = key
+	return &cl
+}
+
+// NewTransport returns a HTTP transport using the proxy and CA bundle configured in cfg.
+// Without explicit proxy the proxy environment variables (HTTPS_PROXY, NO_PROXY, ...) are used.
+func NewTransport(cfg *config.Config) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.Atlas.ProxyURL != "" {
+		u, err := url.Parse(cfg.Atlas.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if cfg.Atlas.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		b, err := os.ReadFile(cfg.Atlas.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.Atlas.CAFile)
+		}
+
+		t.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return t, nil
+}
+
+// Get requests a path relative to the base URL (e.g. /probes/1/) and returns the response body
+func (c *Client) Get(path string, query url.Values) ([]byte, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	return c.get(u)
+}
+
+func (c *Client) get(u string) ([]byte, error) {
+	status, b, err := c.fetch(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, &StatusError{StatusCode: status, Path: strings.TrimPrefix(u, c.baseURL)}
+	}
+
+	return b, nil
+}
+
+// fetch requests the URL and returns status code and body of the response.
+// Temporary failures are retried, the response of the last attempt is returned.
+func (c *Client) fetch(u string) (int, []byte, error) {
+	for attempt := uint(0); ; attempt++ {
+		status, h, b, err := c.do(u)
+		if !retryable(c.ctx, status, err) || attempt >= c.retries {
+			return status, b, err
+		}
+
+		d := retryDelay(attempt, c.backoff, h)
+		log.Debugf("Retrying %s in %v (attempt %d of %d, status %d, error %v)", u, d, attempt+1, c.retries, status, err)
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-c.ctx.Done():
+			t.Stop()
+			return 0, nil, c.ctx.Err()
+		}
+	}
+}
+
+func (c *Client) do(u string) (int, http.Header, []byte, error) {
+	if err := c.limiter.Wait(c.ctx); err != nil {
+		return 0, nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	if c.key != "" {
+		req.Header.Set("Authorization", "Key "+string(c.key))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	b, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header, b, err
+}
+
+// Measurements is not supported by this client
+func (c *Client) Measurements(p ripeatlas.Params) (<-chan *ripeatlas.Measurement, error) {
+	return nil, errors.New("unimplemented")
+}
+
+// Probes is not supported by this client, probe information is retrieved by the probe package
+func (c *Client) Probes(p ripeatlas.Params) (<-chan *request.Probe, error) {
+	return nil, errors.New("unimplemented")
+}
+
+// MeasurementLatest gets the latest results of a measurement.
+//
+// Params available are:
+//
+// "pk": string - The measurement id to read results from (required).
+func (c *Client) MeasurementLatest(p ripeatlas.Params) (<-chan *measurement.Result, error) {
+	pk, _, err := resultParams(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.results(fmt.Sprintf("/measurements/%s/latest/", url.PathEscape(pk)), url.Values{})
+}
+
+// MeasurementResults gets the results of a measurement.
+//
+// Params available are:
+//
+// "pk": string - The measurement id to read results from (required).
+//
+// "start": int64 - Get the results starting at the given UNIX timestamp.
+//
+// "stop": int64 - Get the results up to the given UNIX timestamp.
+func (c *Client) MeasurementResults(p ripeatlas.Params) (<-chan *measurement.Result, error) {
+	pk, query, err := resultParams(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.results(fmt.Sprintf("/measurements/%s/results/", url.PathEscape(pk)), query)
+}
+
+func resultParams(p ripeatlas.Params) (string, url.Values, error) {
+	var pk string
+	query := url.Values{}
+
+	for k, v := range p {
+		switch k {
+		case "pk":
+			s, ok := v.(string)
+			if !ok {
+				return "", nil, fmt.Errorf("invalid %s parameter, must be string", k)
+			}
+			pk = s
+		case "start", "stop":
+			i, ok := v.(int64)
+			if !ok {
+				return "", nil, fmt.Errorf("invalid %s parameter, must be int64", k)
+			}
+			query.Set(k, fmt.Sprint(i))
+		default:
+			return "", nil, fmt.Errorf("invalid parameter %s", k)
+		}
+	}
+
+	if pk == "" {
+		return "", nil, errors.New("required parameter pk missing")
+	}
+
+	return pk, query, nil
+}
+
+func (c *Client) results(path string, query url.Values) (<-chan *measurement.Result, error) {
+	query.Set("format", "json")
+
+	b, err := c.Get(path, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*measurement.Result
+	err = json.Unmarshal(b, &res)
+
+	ch := make(chan *measurement.Result)
+	go func() {
+		defer close(ch)
+
+		if err != nil {
+			ch <- &measurement.Result{ParseError: fmt.Errorf("json.Unmarshal(%s): %w", path, err)}
+			return
+		}
+
+		for _, r := range res {
+			ch <- r
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DNS-OARC/ripeatlas"
+	"github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{}
+	cfg.Atlas.APIURL = srv.URL + "/api/v2/"
+
+	c, err := NewClient(cfg)
+	require.NoError(t, err)
+	return c
+}
+
+func collect(ch <-chan *measurement.Result) []*measurement.Result {
+	res := []*measurement.Result{}
+	for r := range ch {
+		res = append(res, r)
+	}
+	return res
+}
+
+func TestMeasurementLatestUsesBaseURL(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v2/measurements/1001/latest/", r.URL.Path)
+		require.Equal(t, "json", r.URL.Query().Get("format"))
+		_, _ = w.Write([]byte(`[{"msm_id":1001,"prb_id":1,"type":"ping"},{"msm_id":1001,"prb_id":2,"type":"ping"}]`))
+	})
+
+	ch, err := c.MeasurementLatest(ripeatlas.Params{"pk": "1001"})
+	require.NoError(t, err)
+
+	res := collect(ch)
+	require.Len(t, res, 2)
+	require.NoError(t, res[0].ParseError)
+	require.Equal(t, 2, res[1].PrbId())
+}
+
+func TestMeasurementResultsTimeRange(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v2/measurements/1001/results/", r.URL.Path)
+		require.Equal(t, "100", r.URL.Query().Get("start"))
+		require.Equal(t, "200", r.URL.Query().Get("stop"))
+		_, _ = w.Write([]byte(`not json`))
+	})
+
+	ch, err := c.MeasurementResults(ripeatlas.Params{"pk": "1001", "start": int64(100), "stop": int64(200)})
+	require.NoError(t, err)
+
+	res := collect(ch)
+	require.Len(t, res, 1)
+	require.Error(t, res[0].ParseError)
+
+	_, err = c.MeasurementResults(ripeatlas.Params{"start": int64(100)})
+	require.Error(t, err)
+}
+
+func TestNewTransport_InvalidCAFile(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Atlas.CAFile = "/does/not/exist.pem"
+
+	_, err := NewTransport(cfg)
+	require.Error(t, err)
+}
+
+func TestAPIKeyHeader(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{}
+	cfg.Atlas.APIURL = srv.URL
+	cfg.Atlas.APIKey = "global"
+
+	c, err := NewClient(cfg)
+	require.NoError(t, err)
+
+	_, err = c.Get("/probes/1/", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Key global", auth)
+
+	_, err = c.WithKey("other").Get("/probes/1/", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Key other", auth)
+
+	_, err = c.WithKey("").Get("/probes/1/", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Key global", auth)
+}
+
+func TestSearchMeasurementsFollowsPages(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v2/measurements/", r.URL.Path)
+		require.Equal(t, "dns", r.URL.Query().Get("tags"))
+
+		if r.URL.Query().Get("page") == "" {
+			// next links of the API point to the public host, they have to be rewritten to the configured URL
+			_, _ = w.Write([]byte(`{"next":"https://atlas.ripe.net/api/v2/measurements/?page=2&tags=dns","results":[{"id":1001,"type":"ping","status":{"id":2,"name":"Ongoing"}}]}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"next":null,"results":[{"id":1002,"type":"dns","description":"resolver"}]}`))
+	})
+
+	res, err := c.SearchMeasurements(url.Values{"tags": []string{"dns"}})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, 2, res[0].Status.ID)
+	require.Equal(t, "resolver", res[1].Description)
+}
+
+func TestSearchMeasurementsFailsOnErrorStatus(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	_, err := c.SearchMeasurements(url.Values{})
+	require.Error(t, err)
+}
+
+func TestGetMeasurement(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/measurements/1001/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":1001,"type":"ping","af":4,"interval":240,"description":"k-root","target":"k.root-servers.net",
+			"status":{"id":4,"name":"Stopped"},"start_time":1000,"stop_time":2000,"participant_count":null}`))
+	})
+
+	m, err := c.GetMeasurement("1001")
+	require.NoError(t, err)
+	require.Equal(t, "k-root", m.Description)
+	require.Equal(t, "Stopped", m.Status.Name)
+	require.Equal(t, int64(2000), m.StopTime)
+	require.Nil(t, m.ParticipantCount)
+
+	_, err = c.GetMeasurement("1002")
+	require.Error(t, err)
+}
+
+func TestRetries(t *testing.T) {
+	requests := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_, _ = w.Write([]byte(`{"id":1}`))
+		}
+	})
+	c.retries = 2
+	c.backoff = time.Millisecond
+
+	b, err := c.Get("/probes/1/", nil)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id":1}`, string(b))
+	require.Equal(t, 3, requests)
+
+	// permanent errors are not retried
+	requests = 0
+	c = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	})
+	c.retries = 2
+
+	_, err = c.Get("/probes/1/", nil)
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	require.Equal(t, 1, requests)
+}
+
+func TestRetriesCanceled(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	c.retries = 5
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.WithContext(ctx).Get("/probes/1/", nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(100, 2)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, l.Wait(context.Background()))
+	}
+
+	// 2 requests of the burst are allowed immediately, the other 2 have to wait 10ms each
+	require.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+	require.Nil(t, newLimiter(0, 10))
+}
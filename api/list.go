@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type page struct {
+	Next    string            `json:"next"`
+	Results []json.RawMessage `json:"results"`
+}
+
+// List requests a list endpoint relative to the base URL (e.g. /probes/) and returns the raw items of all pages
+func (c *Client) List(path string, query url.Values) ([]json.RawMessage, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("format", "json")
+
+	res := make([]json.RawMessage, 0)
+	u := c.baseURL + path + "?" + q.Encode()
+	for u != "" {
+		status, b, err := c.fetch(u)
+		if err != nil {
+			return nil, err
+		}
+
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d listing %s", status, path)
+		}
+
+		p := page{}
+		if err := json.Unmarshal(b, &p); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal(%s): %w", path, err)
+		}
+
+		res = append(res, p.Results...)
+		u, err = c.nextPage(path, p.Next)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// nextPage makes sure the link to the next page points to the configured API (e.g. a mock server or proxy)
+func (c *Client) nextPage(path, next string) (string, error) {
+	if next == "" {
+		return "", nil
+	}
+
+	n, err := url.Parse(next)
+	if err != nil {
+		return "", fmt.Errorf("invalid next page URL: %w", err)
+	}
+
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	i := strings.Index(n.Path, path)
+	if i < 0 {
+		return "", fmt.Errorf("unexpected next page URL %s", next)
+	}
+
+	base.Path = strings.TrimSuffix(base.Path, "/") + n.Path[i:]
+	base.RawQuery = n.RawQuery
+	return base.String(), nil
+}
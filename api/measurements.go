@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const measurementsPageSize = 500
+
+// Measurement is the definition of a measurement as returned by the measurements API
+type Measurement struct {
+	ID          int      `json:"id"`
+	Type        string   `json:"type"`
+	Target      string   `json:"target"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	AF          int      `json:"af"`
+	IsPublic    bool     `json:"is_public"`
+	Interval    int      `json:"interval"`
+	Status      struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"status"`
+	StartTime        int64 `json:"start_time"`
+	StopTime         int64 `json:"stop_time"`
+	ParticipantCount *int  `json:"participant_count"`
+}
+
+// GetMeasurement returns the definition of a measurement
+func (c *Client) GetMeasurement(id string) (*Measurement, error) {
+	status, b, err := c.fetch(c.baseURL + "/measurements/" + url.PathEscape(id) + "/?format=json")
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d getting measurement %s", status, id)
+	}
+
+	m := &Measurement{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal(/measurements/%s/): %w", id, err)
+	}
+
+	return m, nil
+}
+
+// SearchMeasurements returns all measurements matching the filters in query (e.g. tags, type, status__in).
+// All pages of the result are retrieved.
+func (c *Client) SearchMeasurements(query url.Values) ([]*Measurement, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("page_size", fmt.Sprint(measurementsPageSize))
+
+	// an incomplete result would unsubscribe measurements, so errors must not be ignored here
+	items, err := c.List("/measurements/", q)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Measurement, 0, len(items))
+	for _, b := range items {
+		m := &Measurement{}
+		if err := json.Unmarshal(b, m); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal(/measurements/): %w", err)
+		}
+		res = append(res, m)
+	}
+
+	return res, nil
+}
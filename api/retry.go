@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package api
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+
+	// maxRetryAfter limits the delay requested by the API, so a single response can not stall scrapes for hours
+	maxRetryAfter = 5 * time.Minute
+)
+
+// retryable returns true if the request failed temporarily (rate limited, server error or network error)
+func retryable(ctx context.Context, status int, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// retryDelay returns the delay requested by the Retry-After header or exponential backoff with jitter
+func retryDelay(attempt uint, base time.Duration, h http.Header) time.Duration {
+	if d, ok := retryAfter(h); ok {
+		return min(d, maxRetryAfter)
+	}
+
+	d := maxBackoff
+	if attempt < 16 {
+		d = min(base<<attempt, maxBackoff)
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	// ±25% jitter, so clients do not retry in lockstep
+	return d - d/4 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func retryAfter(h http.Header) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if s, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(s)*time.Second, 0), true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package atlas
+
+import (
+	"github.com/czerwonk/atlas_exporter/api"
+	"github.com/czerwonk/atlas_exporter/config"
+)
+
+var client *api.Client
+
+// InitClient initializes the client used to access the RIPE Atlas API
+func InitClient(cfg *config.Config) error {
+	c, err := api.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	client = c
+	return nil
+}
+
+// APIClient returns the client used to access the RIPE Atlas API
+func APIClient() *api.Client {
+	return client
+}
@@ -3,8 +3,11 @@
 package atlas
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/DNS-OARC/ripeatlas/measurement"
 	"github.com/czerwonk/atlas_exporter/config"
@@ -16,84 +19,164 @@ import (
 	"github.com/czerwonk/atlas_exporter/probe"
 	"github.com/czerwonk/atlas_exporter/sslcert"
 	"github.com/czerwonk/atlas_exporter/traceroute"
+	log "github.com/sirupsen/logrus"
 )
 
-func probesForResults(res []*measurement.Result, workers uint) (map[int]*probe.Probe, error) {
+// probesForResults returns the probes of the results. Probes not cached are retrieved in batches of batchSize
+// using at most workers concurrent requests. Placeholders are returned for probes which could not be retrieved.
+func probesForResults(ctx context.Context, res []*measurement.Result, workers, batchSize uint) map[int]*probe.Probe {
 	probes := make(map[int]*probe.Probe)
+	missing := make([]int, 0)
+	stale := make([]int, 0)
+	seen := make(map[int]bool)
+
+	for _, r := range res {
+		id := r.PrbId()
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		p, state := cache.Lookup(id)
+		switch state {
+		case probe.Fresh:
+			probes[id] = p
+		case probe.Stale:
+			probes[id] = p
+			if cache.StartRefresh(id) {
+				stale = append(stale, id)
+			}
+		case probe.Failed:
+			probes[id] = probe.NewPlaceholder(id)
+		default:
+			missing = append(missing, id)
+		}
+	}
+
+	if len(stale) > 0 {
+		go refreshProbes(stale, batchSize)
+	}
+
+	mu := sync.Mutex{}
+	sem := make(chan struct{}, max(workers, 1))
+	wg := sync.WaitGroup{}
 
-	in := startProducer(res)
-	out := make(chan *probe.Probe)
-	errCh := make(chan error)
-
-	go func() {
-		startConsumers(in, out, errCh, int(workers))
-	}()
-
-	for {
-		select {
-		case err := <-errCh:
-			return nil, err
-		case p, more := <-out:
-			if !more {
-				return probes, nil
+	for _, ids := range batches(missing, int(max(batchSize, 1))) {
+		wg.Add(1)
+		go func(ids []int) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			found, err := fetchProbes(ctx, ids)
+
+			if err != nil {
+				log.Errorf("%v, using placeholders", err)
 			}
 
-			probes[p.ID] = p
-		}
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, id := range ids {
+				if p, ok := found[id]; ok {
+					probes[id] = p
+				} else {
+					probes[id] = probe.NewPlaceholder(id)
+				}
+			}
+		}(ids)
 	}
+
+	wg.Wait()
+
+	return probes
 }
 
-func startProducer(res []*measurement.Result) chan int {
-	ch := make(chan int)
+func batches(ids []int, size int) [][]int {
+	res := make([][]int, 0, (len(ids)+size-1)/size)
+	for len(ids) > size {
+		res = append(res, ids[:size])
+		ids = ids[size:]
+	}
 
-	go func() {
-		added := make(map[int]bool)
+	if len(ids) > 0 {
+		res = append(res, ids)
+	}
 
-		for _, m := range res {
-			if _, found := added[m.PrbId()]; found {
-				continue
-			}
+	return res
+}
 
-			ch <- m.PrbId()
-			added[m.PrbId()] = true
+// refreshProbes retrieves stale probes in background
+func refreshProbes(ids []int, batchSize uint) {
+	for _, b := range batches(ids, int(max(batchSize, 1))) {
+		if _, err := fetchProbes(context.Background(), b); err != nil {
+			log.Warnf("could not refresh probes: %v", err)
 		}
+	}
+}
 
-		close(ch)
-	}()
+// fetchProbes retrieves the probes with a single request and adds them to the cache.
+// Probes missing in the response are requested one by one, the returned map contains all probes retrieved.
+// Failed lookups are recorded in the cache.
+func fetchProbes(ctx context.Context, ids []int) (map[int]*probe.Probe, error) {
+	l, err := observeProbeRequest("batch", func() ([]*probe.Probe, error) {
+		return probe.GetMany(client.WithContext(ctx), ids)
+	})
+	if err != nil {
+		addFailed(ctx, ids...)
+		return nil, fmt.Errorf("could not retrieve probe information for %d probes: %v", len(ids), err)
+	}
 
-	return ch
-}
+	probes := make(map[int]*probe.Probe, len(ids))
+	for _, p := range l {
+		cache.Add(p.ID, p)
+		probes[p.ID] = p
+	}
 
-func startConsumers(idChan chan int, out chan<- *probe.Probe, errCh chan<- error, workers int) {
-	wg := sync.WaitGroup{}
-	wg.Add(workers)
+	var firstErr error
+	for _, id := range ids {
+		if _, found := probes[id]; found {
+			continue
+		}
 
-	for i := 0; i < workers; i++ {
-		go func() {
-			defer wg.Done()
-			for id := range idChan {
-				p, err := probeForID(id)
-				if err != nil {
-					errCh <- err
-					continue
-				}
-				out <- p
+		p, err := fetchProbe(ctx, id)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
 			}
-		}()
+			continue
+		}
+		probes[id] = p
 	}
 
-	wg.Wait()
-	close(out)
+	return probes, firstErr
 }
 
-func probeForID(id int) (*probe.Probe, error) {
-	p, found := cache.Get(id)
-	if found {
+// probeForID returns the probe from the cache or retrieves it. Stale probes are refreshed in background.
+func probeForID(ctx context.Context, id int) (*probe.Probe, error) {
+	p, state := cache.Lookup(id)
+	switch state {
+	case probe.Fresh:
+		return p, nil
+	case probe.Stale:
+		if cache.StartRefresh(id) {
+			go refreshProbes([]int{id}, 1)
+		}
 		return p, nil
+	case probe.Failed:
+		return nil, failedLookupError(id)
 	}
 
-	p, err := probe.Get(id)
+	return fetchProbe(ctx, id)
+}
+
+func fetchProbe(ctx context.Context, id int) (*probe.Probe, error) {
+	p, err := observeProbeRequest("single", func() (*probe.Probe, error) {
+		return probe.Get(client.WithContext(ctx), id)
+	})
 	if err != nil {
+		addFailed(ctx, id)
 		return nil, fmt.Errorf("could not retrieve probe information for probe %d: %v", id, err)
 	}
 
@@ -101,21 +184,68 @@ func probeForID(id int) (*probe.Probe, error) {
 	return p, nil
 }
 
-func measurementForType(t, id, ipVersion string, cfg *config.Config) (*exporter.Measurement, error) {
+// observeProbeRequest counts the request to the probes API and observes its latency and errors
+func observeProbeRequest[T any](t string, f func() (T, error)) (T, error) {
+	ProbeRequestsCounter.WithLabelValues(t).Inc()
+
+	start := time.Now()
+	res, err := f()
+	ProbeAPIRequestDuration.WithLabelValues(t).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		ProbeAPIErrorsCounter.WithLabelValues(t).Inc()
+	}
+
+	return res, err
+}
+
+// addFailed records failed lookups in the cache, unless they failed as the request was canceled
+func addFailed(ctx context.Context, ids ...int) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	for _, id := range ids {
+		cache.AddFailed(id)
+	}
+}
+
+func failedLookupError(id int) error {
+	return fmt.Errorf("could not retrieve probe information for probe %d: lookup failed recently", id)
+}
+
+func measurementForType(t, id, ipVersion string, s config.MeasurementSettings) (*exporter.Measurement, error) {
 	switch t {
 	case "ping":
-		return ping.NewMeasurement(id, ipVersion, cfg), nil
+		return ping.NewMeasurement(id, ipVersion, s), nil
 	case "traceroute":
-		return traceroute.NewMeasurement(id, ipVersion, cfg), nil
+		return traceroute.NewMeasurement(id, ipVersion, s), nil
 	case "ntp":
-		return ntp.NewMeasurement(id, cfg), nil
+		return ntp.NewMeasurement(id, s), nil
 	case "dns":
-		return dns.NewMeasurement(id, ipVersion, cfg), nil
+		return dns.NewMeasurement(id, ipVersion, s), nil
 	case "http":
-		return http.NewMeasurement(id, ipVersion, cfg), nil
+		return http.NewMeasurement(id, ipVersion, s), nil
 	case "sslcert":
-		return sslcert.NewMeasurement(id, cfg), nil
+		return sslcert.NewMeasurement(id, s), nil
 	}
 
 	return nil, fmt.Errorf("type %s is not supported yet", t)
 }
+
+// rebuildMeasurement builds the measurement using the settings s and adds the results held by mes.
+// Returns nil if mes does not hold any results.
+func rebuildMeasurement(id string, mes *exporter.Measurement, s config.MeasurementSettings) (*exporter.Measurement, error) {
+	res := mes.Results()
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	nm, err := measurementForType(res[0].Type(), id, strconv.Itoa(res[0].Af()), s)
+	if err != nil {
+		return nil, err
+	}
+
+	mes.CopyTo(nm)
+	return nm, nil
+}
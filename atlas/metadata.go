@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package atlas
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/czerwonk/atlas_exporter/api"
+	"github.com/czerwonk/atlas_exporter/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// MeasurementMetadata returns the definitions of the measurements, retrieving definitions not cached from the API
+// using at most workers concurrent requests. Measurements whose definition could not be retrieved (in time) are skipped,
+// failed lookups are not retried within the negative TTL of the cache.
+func MeasurementMetadata(ctx context.Context, ids []string, workers uint, keyFor func(id string) config.Secret) []*api.Measurement {
+	res := make([]*api.Measurement, 0, len(ids))
+	ch := make(chan *api.Measurement, len(ids))
+	sem := make(chan struct{}, max(workers, 1))
+	wg := sync.WaitGroup{}
+
+	for _, id := range ids {
+		if m, found := metadataCache.Get(id); found {
+			res = append(res, m)
+			continue
+		}
+
+		if metadataCache.Failed(id) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			m, err := client.WithKey(keyFor(id)).WithContext(ctx).GetMeasurement(id)
+			if err != nil {
+				log.Errorf("could not retrieve definition of measurement %s: %v", id, err)
+				if ctx.Err() == nil {
+					metadataCache.AddFailed(id)
+				}
+				return
+			}
+
+			metadataCache.Add(id, m)
+			ch <- m
+		}(id)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warnf("could not retrieve all measurement definitions in time: %v", ctx.Err())
+	}
+
+	for collecting := true; collecting; {
+		select {
+		case m := <-ch:
+			res = append(res, m)
+		default:
+			collecting = false
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+
+	return res
+}
@@ -0,0 +1,48 @@
+package atlas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/metadata"
+)
+
+func TestMeasurementMetadata_CachesFailedLookups(t *testing.T) {
+	prevClient, prevCache := client, metadataCache
+	defer func() { client, metadataCache = prevClient, prevCache }()
+
+	requests := atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/measurements/1001/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":1001,"type":"ping","interval":240}`))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{}
+	cfg.Atlas.APIURL = srv.URL
+	if err := InitClient(cfg); err != nil {
+		t.Fatal(err)
+	}
+	metadataCache = metadata.NewCache(time.Hour, metadata.WithNegativeTTL(time.Hour))
+
+	noKey := func(string) config.Secret { return "" }
+	for range 2 {
+		ms := MeasurementMetadata(context.Background(), []string{"1001", "9999"}, 2, noKey)
+		if len(ms) != 1 || ms[0].ID != 1001 {
+			t.Fatalf("expected definition of 1001 only, got %v", ms)
+		}
+	}
+
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected unknown measurement to be requested once, got %d requests", n)
+	}
+}
@@ -44,8 +44,134 @@ var (
 			Buckets: prometheus.DefBuckets,
 		},
 	)
+
+	// ConfigReloadsCounter counts configuration reloads by result (success, failure)
+	ConfigReloadsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_config_reloads_total",
+			Help: "Number of configuration reloads by result",
+		},
+		[]string{"result"},
+	)
+
+	// ProbeRequestsCounter counts requests to the probes API by type (batch, single)
+	ProbeRequestsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_probe_requests_total",
+			Help: "Number of requests to the probes API by type (batch: id__in lookup, single: lookup of one probe)",
+		},
+		[]string{"type"},
+	)
+
+	// DegradedResultsCounter counts results added with a placeholder probe as the probe could not be retrieved
+	DegradedResultsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_degraded_results_total",
+			Help: "Number of results exported with placeholder probe labels as the probe information could not be retrieved",
+		},
+		[]string{"measurement_id"},
+	)
+
+	// ProbeAPIRequestDuration measures the latency of requests to the probes API by type (batch, single)
+	ProbeAPIRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "atlas_exporter_probe_api_request_duration_seconds",
+			Help:    "Latency of requests to the probes API by type (including retries)",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"type"},
+	)
+
+	// ProbeAPIErrorsCounter counts failed requests to the probes API by type (batch, single)
+	ProbeAPIErrorsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_probe_api_errors_total",
+			Help: "Number of failed requests to the probes API by type",
+		},
+		[]string{"type"},
+	)
+
+	// StreamReconnectsCounter counts reconnects to the Streaming API after a connection was lost
+	StreamReconnectsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_stream_reconnects_total",
+			Help: "Number of reconnects after the websocket stream of a measurement was lost",
+		},
+		[]string{"measurement_id"},
+	)
+
+	// StreamSubscribeFailuresCounter counts failed attempts to connect and subscribe to the Streaming API
+	StreamSubscribeFailuresCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_stream_subscribe_failures_total",
+			Help: "Number of failed attempts to subscribe to the results of a measurement",
+		},
+		[]string{"measurement_id"},
+	)
+
+	// ConfigLastReloadSuccessfulGauge tracks whether the last configuration reload succeeded
+	ConfigLastReloadSuccessfulGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "atlas_exporter_config_last_reload_successful",
+			Help: "Whether the last configuration reload attempt was successful (1) or not (0)",
+		},
+	)
 )
 
+// HeldResultsCollector returns a collector exporting the number of results held per measurement by the strategy
+func HeldResultsCollector(s StatusReporter, ids []string) prometheus.Collector {
+	g := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "atlas_exporter_measurement_results",
+			Help: "Number of results (one per probe) held for a measurement",
+		},
+		[]string{"measurement_id"},
+	)
+
+	for _, id := range ids {
+		g.WithLabelValues(id).Set(float64(s.MeasurementStatus(id).Probes))
+	}
+
+	return g
+}
+
+// StreamQueueLengthCollector returns a collector exporting the number of results queued by the strategy.
+// The length is read on collection, so it is also reported while results are not processed.
+func StreamQueueLengthCollector(q QueueReporter) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "atlas_exporter_stream_queue_length",
+		Help: "Number of streamed results waiting to be processed",
+	}, func() float64 {
+		return float64(q.QueueLength())
+	})
+}
+
+// ProbeCacheCollectors returns collectors exporting hits, misses, evictions and size of the probe cache
+func ProbeCacheCollectors() []prometheus.Collector {
+	if cache == nil {
+		return nil
+	}
+
+	return []prometheus.Collector{
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "atlas_exporter_probe_cache_hits_total",
+			Help: "Number of probe cache lookups served from the cache (including stale probes)",
+		}, func() float64 { return float64(cache.Stats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "atlas_exporter_probe_cache_misses_total",
+			Help: "Number of probe cache lookups of probes not cached or failed recently",
+		}, func() float64 { return float64(cache.Stats().Misses) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "atlas_exporter_probe_cache_evictions_total",
+			Help: "Number of probes evicted from the cache as the max. size was exceeded",
+		}, func() float64 { return float64(cache.Stats().Evictions) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "atlas_exporter_probe_cache_size",
+			Help: "Number of items in the probe cache (including failed lookups)",
+		}, func() float64 { return float64(cache.Len()) }),
+	}
+}
+
 // SetBuildInfo sets the build_info gauge with version, go version and vcs revision
 func SetBuildInfo(version string) {
 	goVersion := runtime.Version()
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package atlas
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/probe"
+	log "github.com/sirupsen/logrus"
+)
+
+type probeCallback func(p *probe.Probe, err error)
+
+// probeBatcher coalesces lookups of probes not cached. Probes requested within the window
+// (or until the batch is full) are retrieved by a single request.
+type probeBatcher struct {
+	size   int
+	window time.Duration
+	fetch  func(ids []int) (map[int]*probe.Probe, error)
+
+	mu      sync.Mutex
+	pending map[int][]probeCallback
+	queued  []int
+	timer   *time.Timer
+}
+
+func newProbeBatcher(ctx context.Context, size uint, window time.Duration) *probeBatcher {
+	return &probeBatcher{
+		size:   int(max(size, 1)),
+		window: window,
+		fetch: func(ids []int) (map[int]*probe.Probe, error) {
+			return fetchProbes(ctx, ids)
+		},
+		pending: make(map[int][]probeCallback),
+	}
+}
+
+// Lookup calls f with the probe. For cached probes (including stale probes, which are refreshed with the next
+// batch) f is called immediately, otherwise after the batch containing the probe was retrieved.
+// Callbacks for the same probe are called in order of the lookups.
+func (b *probeBatcher) Lookup(id int, f probeCallback) {
+	b.mu.Lock()
+
+	if cbs, found := b.pending[id]; found {
+		b.pending[id] = append(cbs, f)
+		b.mu.Unlock()
+		return
+	}
+
+	p, state := cache.Lookup(id)
+	switch state {
+	case probe.Fresh, probe.Stale:
+		var ids []int
+		if state == probe.Stale && cache.StartRefresh(id) {
+			ids = b.enqueue(id)
+		}
+		b.mu.Unlock()
+
+		b.flushAsync(ids)
+		f(p, nil)
+		return
+	case probe.Failed:
+		b.mu.Unlock()
+		f(nil, failedLookupError(id))
+		return
+	}
+
+	b.pending[id] = []probeCallback{f}
+	ids := b.enqueue(id)
+	b.mu.Unlock()
+
+	b.flushAsync(ids)
+}
+
+// enqueue adds the probe to the next batch. The IDs of the batch are returned if it is full. b.mu has to be held.
+func (b *probeBatcher) enqueue(id int) []int {
+	b.queued = append(b.queued, id)
+
+	if len(b.queued) >= b.size {
+		return b.takeQueued()
+	}
+
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, func() {
+			b.mu.Lock()
+			ids := b.takeQueued()
+			b.mu.Unlock()
+
+			b.flush(ids)
+		})
+	}
+
+	return nil
+}
+
+func (b *probeBatcher) flushAsync(ids []int) {
+	if len(ids) > 0 {
+		go b.flush(ids)
+	}
+}
+
+// takeQueued returns the queued probe IDs and resets the queue. b.mu has to be held.
+func (b *probeBatcher) takeQueued() []int {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	ids := b.queued
+	b.queued = nil
+	return ids
+}
+
+func (b *probeBatcher) flush(ids []int) {
+	if len(ids) == 0 {
+		return
+	}
+
+	log.Debugf("Retrieving %d probes", len(ids))
+	probes, err := b.fetch(ids)
+
+	for _, id := range ids {
+		p := probes[id]
+
+		var perr error
+		if p == nil {
+			perr = err
+			if perr == nil {
+				perr = fmt.Errorf("could not retrieve probe information for probe %d", id)
+			}
+		}
+
+		b.notify(id, p, perr)
+	}
+}
+
+// notify calls the callbacks waiting for the probe, including callbacks added meanwhile
+func (b *probeBatcher) notify(id int, p *probe.Probe, err error) {
+	for {
+		b.mu.Lock()
+		cbs := b.pending[id]
+		if len(cbs) == 0 {
+			delete(b.pending, id)
+			b.mu.Unlock()
+			return
+		}
+		b.pending[id] = []probeCallback{}
+		b.mu.Unlock()
+
+		for _, f := range cbs {
+			callProbeCallback(id, f, p, err)
+		}
+	}
+}
+
+func callProbeCallback(id int, f probeCallback, p *probe.Probe, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Panic processing result of probe %d: %v", id, r)
+		}
+	}()
+
+	f(p, err)
+}
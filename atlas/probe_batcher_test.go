@@ -0,0 +1,75 @@
+package atlas
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/probe"
+)
+
+func TestProbeBatcher(t *testing.T) {
+	cache = probe.NewCache(time.Hour)
+	cache.Add(1, &probe.Probe{ID: 1})
+
+	mu := sync.Mutex{}
+	batches := [][]int{}
+
+	b := newProbeBatcher(context.Background(), 3, 50*time.Millisecond)
+	b.fetch = func(ids []int) (map[int]*probe.Probe, error) {
+		mu.Lock()
+		batches = append(batches, ids)
+		mu.Unlock()
+
+		res := make(map[int]*probe.Probe)
+		for _, id := range ids {
+			if id != 5 {
+				res[id] = &probe.Probe{ID: id}
+				cache.Add(id, res[id])
+			}
+		}
+		return res, nil
+	}
+
+	wg := sync.WaitGroup{}
+	got := make(chan string, 10)
+	lookup := func(id int) {
+		wg.Add(1)
+		b.Lookup(id, func(p *probe.Probe, err error) {
+			defer wg.Done()
+			if err != nil {
+				got <- fmt.Sprintf("%d:error", id)
+				return
+			}
+			got <- fmt.Sprintf("%d:%d", id, p.ID)
+		})
+	}
+
+	// cached probe is passed immediately
+	lookup(1)
+	if r := <-got; r != "1:1" {
+		t.Fatalf("expected cached probe, got %s", r)
+	}
+
+	// 2, 3 and 4 fill a batch, 5 is retrieved after the window
+	for _, id := range []int{2, 3, 2, 4, 5} {
+		lookup(id)
+	}
+	wg.Wait()
+	close(got)
+
+	results := make(map[string]int)
+	for r := range got {
+		results[r]++
+	}
+
+	if results["2:2"] != 2 || results["3:3"] != 1 || results["4:4"] != 1 || results["5:error"] != 1 {
+		t.Fatalf("unexpected results: %v", results)
+	}
+
+	if len(batches) != 2 || len(batches[0]) != 3 || len(batches[1]) != 1 {
+		t.Fatalf("expected batches [2 3 4] and [5], got %v", batches)
+	}
+}
@@ -6,16 +6,105 @@ import (
 	"context"
 	"time"
 
+	"github.com/czerwonk/atlas_exporter/metadata"
 	"github.com/czerwonk/atlas_exporter/probe"
 	log "github.com/sirupsen/logrus"
 )
 
-var cache *probe.Cache
+var (
+	cache         *probe.Cache
+	metadataCache *metadata.Cache
+	cacheFile     string
+)
+
+// CacheOpt are options to apply when initializing the caches
+type CacheOpt func(o *cacheOptions)
+
+type cacheOptions struct {
+	file         string
+	saveInterval time.Duration
+	probeOpts    []probe.CacheOpt
+	metadataOpts []metadata.CacheOpt
+}
+
+// WithProbeCacheOpts applies options (e.g. stale and negative TTL, max. size) to the probe cache
+func WithProbeCacheOpts(opts ...probe.CacheOpt) CacheOpt {
+	return func(o *cacheOptions) {
+		o.probeOpts = append(o.probeOpts, opts...)
+	}
+}
+
+// WithMetadataCacheOpts applies options (e.g. negative TTL) to the cache of measurement definitions
+func WithMetadataCacheOpts(opts ...metadata.CacheOpt) CacheOpt {
+	return func(o *cacheOptions) {
+		o.metadataOpts = append(o.metadataOpts, opts...)
+	}
+}
 
-// InitCache initializes the cache
-func InitCache(ctx context.Context, ttl, cleanup time.Duration) {
-	cache = probe.NewCache(ttl)
+// WithCacheFile persists the probe cache in a file. The file is loaded on initialization,
+// written every interval and by SaveCache.
+func WithCacheFile(path string, interval time.Duration) CacheOpt {
+	return func(o *cacheOptions) {
+		o.file = path
+		o.saveInterval = interval
+	}
+}
+
+// InitCache initializes the caches of probes and measurement definitions
+func InitCache(ctx context.Context, ttl, cleanup time.Duration, opts ...CacheOpt) {
+	o := &cacheOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	cache = probe.NewCache(ttl, o.probeOpts...)
+	metadataCache = metadata.NewCache(ttl, o.metadataOpts...)
 	startCacheCleanupFunc(ctx, cleanup)
+
+	cacheFile = o.file
+	if cacheFile == "" {
+		return
+	}
+
+	n, err := cache.Load(cacheFile)
+	if err != nil {
+		log.Errorf("could not load probe cache: %v", err)
+	} else {
+		log.Infof("Loaded %d probes from cache file %s", n, cacheFile)
+	}
+
+	startCacheSaveFunc(ctx, o.saveInterval)
+}
+
+// SaveCache writes the probe cache to the cache file (if configured)
+func SaveCache() {
+	if cacheFile == "" {
+		return
+	}
+
+	n, err := cache.Save(cacheFile)
+	if err != nil {
+		log.Errorf("could not save probe cache: %v", err)
+		return
+	}
+
+	log.Debugf("Saved %d probes to cache file %s", n, cacheFile)
+}
+
+func startCacheSaveFunc(ctx context.Context, d time.Duration) {
+	go func() {
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				SaveCache()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 }
 
 func startCacheCleanupFunc(ctx context.Context, d time.Duration) {
@@ -27,7 +116,7 @@ func startCacheCleanupFunc(ctx context.Context, d time.Duration) {
 			select {
 			case <-ticker.C:
 				log.Debugln("Cleaning up cache...")
-				r := cache.CleanUp()
+				r := cache.CleanUp() + metadataCache.CleanUp()
 				if r > 0 {
 					log.Infof("Cache items removed: %d", r)
 				}
@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package atlas
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/czerwonk/atlas_exporter/config"
+)
+
+const (
+	// SourceConfig is the registry source of the measurements configured statically
+	SourceConfig = "config"
+	// SourceAdmin is the registry source of the measurements added at runtime
+	SourceAdmin = "admin"
+)
+
+// Registry holds the measurements to export merged from several sources (e.g. configuration file and discovery).
+// When a measurement is provided by more than one source the config source takes precedence.
+// Measurements can be removed or paused at runtime, paused measurements are still exported but not subscribed.
+type Registry struct {
+	setMu     sync.Mutex
+	mu        sync.RWMutex
+	sources   map[string][]config.Measurement
+	removed   map[string]bool
+	paused    map[string]bool
+	merged    []config.Measurement
+	sourceOf  map[string]string
+	active    []config.Measurement
+	listeners []func([]config.Measurement)
+}
+
+// NewRegistry returns a registry containing the measurements configured in cfg
+func NewRegistry(cfg *config.Config) *Registry {
+	r := &Registry{
+		sources:  make(map[string][]config.Measurement),
+		removed:  make(map[string]bool),
+		paused:   make(map[string]bool),
+		sourceOf: make(map[string]string),
+	}
+	r.Set(SourceConfig, cfg.Measurements)
+
+	return r
+}
+
+// Set replaces the measurements of a source
+func (r *Registry) Set(source string, ms []config.Measurement) {
+	r.update(func() bool {
+		r.sources[source] = ms
+		return true
+	})
+}
+
+// Add adds a measurement at runtime. Returns false if the measurement is already registered.
+func (r *Registry) Add(m config.Measurement) bool {
+	return r.update(func() bool {
+		if _, found := r.sourceOf[m.ID]; found {
+			return false
+		}
+
+		delete(r.removed, m.ID)
+		r.sources[SourceAdmin] = append(r.sources[SourceAdmin], m)
+		return true
+	})
+}
+
+// Remove removes a measurement at runtime, regardless of its source. The measurement stays removed
+// until it is added again. Returns false if the measurement is not registered.
+func (r *Registry) Remove(id string) bool {
+	return r.update(func() bool {
+		if _, found := r.sourceOf[id]; !found {
+			return false
+		}
+
+		admin := r.sources[SourceAdmin][:0:0]
+		for _, m := range r.sources[SourceAdmin] {
+			if m.ID != id {
+				admin = append(admin, m)
+			}
+		}
+		r.sources[SourceAdmin] = admin
+
+		r.removed[id] = true
+		delete(r.paused, id)
+		return true
+	})
+}
+
+// Pause unsubscribes a measurement, keeping the results held. Returns false if the measurement is not registered.
+func (r *Registry) Pause(id string) bool {
+	return r.update(func() bool {
+		if _, found := r.sourceOf[id]; !found {
+			return false
+		}
+
+		r.paused[id] = true
+		return true
+	})
+}
+
+// Resume subscribes a paused measurement again. Returns false if the measurement is not registered.
+func (r *Registry) Resume(id string) bool {
+	return r.update(func() bool {
+		if _, found := r.sourceOf[id]; !found {
+			return false
+		}
+
+		delete(r.paused, id)
+		return true
+	})
+}
+
+// update applies f and notifies listeners if the set of active measurements changed
+func (r *Registry) update(f func() bool) bool {
+	// serializes notifications, so listeners never see an outdated set after a newer one
+	r.setMu.Lock()
+	defer r.setMu.Unlock()
+
+	r.mu.Lock()
+	if !f() {
+		r.mu.Unlock()
+		return false
+	}
+
+	r.merge()
+	active := make([]config.Measurement, 0, len(r.merged))
+	for _, m := range r.merged {
+		if !r.paused[m.ID] {
+			active = append(active, m)
+		}
+	}
+	changed := !reflect.DeepEqual(active, r.active)
+	r.active = active
+	listeners := r.listeners
+	r.mu.Unlock()
+
+	if changed {
+		for _, f := range listeners {
+			f(active)
+		}
+	}
+
+	return true
+}
+
+func (r *Registry) merge() {
+	names := make([]string, 0, len(r.sources))
+	for name := range r.sources {
+		if name != SourceConfig {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{SourceConfig}, names...)
+
+	r.sourceOf = make(map[string]string)
+	r.merged = make([]config.Measurement, 0)
+	for _, name := range names {
+		for _, m := range r.sources[name] {
+			if _, found := r.sourceOf[m.ID]; found || r.removed[m.ID] {
+				continue
+			}
+
+			r.sourceOf[m.ID] = name
+			r.merged = append(r.merged, m)
+		}
+	}
+}
+
+// OnChange registers a function called with all active measurements whenever this set changes.
+// The function must not modify the registry.
+func (r *Registry) OnChange(f func([]config.Measurement)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeners = append(r.listeners, f)
+}
+
+// Measurements returns all measurements (including paused ones)
+func (r *Registry) Measurements() []config.Measurement {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ms := make([]config.Measurement, len(r.merged))
+	copy(ms, r.merged)
+	return ms
+}
+
+// Active returns all measurements to subscribe (not paused)
+func (r *Registry) Active() []config.Measurement {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ms := make([]config.Measurement, len(r.active))
+	copy(ms, r.active)
+	return ms
+}
+
+// IDs returns the IDs of all measurements (including paused ones)
+func (r *Registry) IDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, len(r.merged))
+	for i, m := range r.merged {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+// Source returns the name of the source providing the measurement
+func (r *Registry) Source(id string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, found := r.sourceOf[id]
+	return s, found
+}
+
+// IsPaused returns true if the measurement is paused
+func (r *Registry) IsPaused(id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.paused[id]
+}
+
+// APIKeyFor returns the API key to use for requests regarding a measurement
+func (r *Registry) APIKeyFor(cfg *config.Config, id string) config.Secret {
+	if m, found := r.Get(id); found {
+		return apiKeyFor(cfg, m)
+	}
+
+	return cfg.APIKeyFor(id)
+}
+
+// SettingsFor returns the settings to build the measurement with
+func (r *Registry) SettingsFor(cfg *config.Config, id string) config.MeasurementSettings {
+	if m, found := r.Get(id); found {
+		return cfg.SettingsFor(m)
+	}
+
+	return cfg.SettingsForID(id)
+}
+
+func apiKeyFor(cfg *config.Config, m config.Measurement) config.Secret {
+	if m.APIKey != "" {
+		return m.APIKey
+	}
+
+	return cfg.Atlas.APIKey
+}
+
+// Get returns the measurement with the given ID
+func (r *Registry) Get(id string) (config.Measurement, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, m := range r.merged {
+		if m.ID == id {
+			return m, true
+		}
+	}
+
+	return config.Measurement{}, false
+}
@@ -0,0 +1,93 @@
+package atlas
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/czerwonk/atlas_exporter/config"
+)
+
+func TestRegistry_MergesSources(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Atlas.APIKey = "global"
+	cfg.Measurements = []config.Measurement{{ID: "1"}, {ID: "2", APIKey: "static"}}
+
+	r := NewRegistry(cfg)
+
+	calls := 0
+	var got []string
+	r.OnChange(func(ms []config.Measurement) {
+		calls++
+		got = nil
+		for _, m := range ms {
+			got = append(got, m.ID)
+		}
+	})
+
+	r.Set("discovery", []config.Measurement{{ID: "2", APIKey: "discovered"}, {ID: "3", APIKey: "discovered"}})
+	if !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Fatalf("expected measurements 1, 2, 3, got %v", got)
+	}
+
+	if k := r.APIKeyFor(cfg, "2"); k != "static" {
+		t.Fatalf("expected key of config source to take precedence, got %s", string(k))
+	}
+	if k := r.APIKeyFor(cfg, "1"); k != "global" {
+		t.Fatalf("expected global key, got %s", string(k))
+	}
+
+	// unchanged set must not notify listeners
+	r.Set("discovery", []config.Measurement{{ID: "2", APIKey: "discovered"}, {ID: "3", APIKey: "discovered"}})
+	if calls != 1 {
+		t.Fatalf("expected 1 change notification, got %d", calls)
+	}
+
+	r.Set("discovery", nil)
+	if !reflect.DeepEqual(r.IDs(), []string{"1", "2"}) {
+		t.Fatalf("expected measurements 1, 2 after removal, got %v", r.IDs())
+	}
+}
+
+func TestRegistry_AddRemovePause(t *testing.T) {
+	cfg := &config.Config{Measurements: []config.Measurement{{ID: "1"}}}
+	r := NewRegistry(cfg)
+
+	var active []string
+	r.OnChange(func(ms []config.Measurement) {
+		active = nil
+		for _, m := range ms {
+			active = append(active, m.ID)
+		}
+	})
+
+	if r.Add(config.Measurement{ID: "1"}) {
+		t.Fatal("expected adding a registered measurement to fail")
+	}
+	if !r.Add(config.Measurement{ID: "2"}) {
+		t.Fatal("expected measurement 2 to be added")
+	}
+	if s, _ := r.Source("2"); s != SourceAdmin {
+		t.Fatalf("expected source %s, got %s", SourceAdmin, s)
+	}
+
+	if !r.Pause("1") || !reflect.DeepEqual(active, []string{"2"}) {
+		t.Fatalf("expected only measurement 2 to be active, got %v", active)
+	}
+	if !reflect.DeepEqual(r.IDs(), []string{"1", "2"}) {
+		t.Fatalf("expected paused measurement to be kept, got %v", r.IDs())
+	}
+
+	if !r.Remove("1") || r.Remove("1") {
+		t.Fatal("expected measurement 1 to be removed once")
+	}
+
+	// removed measurements stay removed when the config source is set again
+	r.Set(SourceConfig, cfg.Measurements)
+	if !reflect.DeepEqual(r.IDs(), []string{"2"}) {
+		t.Fatalf("expected measurement 1 to stay removed, got %v", r.IDs())
+	}
+
+	if !r.Add(config.Measurement{ID: "1"}) || !reflect.DeepEqual(active, []string{"1", "2"}) {
+		t.Fatalf("expected measurements 1, 2 to be active, got %v", active)
+	}
+}
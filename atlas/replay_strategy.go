@@ -0,0 +1,305 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package atlas
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/exporter"
+	"github.com/czerwonk/atlas_exporter/probe"
+	log "github.com/sirupsen/logrus"
+)
+
+const maxReplayLineSize = 16 * 1024 * 1024
+
+type replayStrategy struct {
+	ctx          context.Context
+	measurements map[string]*exporter.Measurement
+	probes       map[int]*probe.Probe
+	cfg          *config.Config
+	mu           sync.Mutex
+	loaded       int32
+}
+
+// NewReplayStrategy returns a strategy replaying recorded measurement results (one JSON result per line)
+// from a file or directory instead of retrieving them from the Atlas API
+func NewReplayStrategy(ctx context.Context, cfg *config.Config) (Strategy, error) {
+	s := &replayStrategy{
+		ctx:          ctx,
+		cfg:          cfg,
+		measurements: make(map[string]*exporter.Measurement),
+	}
+
+	if cfg.Replay.ProbesFile != "" {
+		probes, err := readProbesFile(cfg.Replay.ProbesFile)
+		if err != nil {
+			return nil, err
+		}
+		s.probes = probes
+		log.Infof("Loaded %d probes from %s", len(probes), cfg.Replay.ProbesFile)
+	}
+
+	results, err := readReplayResults(cfg.Replay.Path)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Loaded %d results to replay from %s", len(results), cfg.Replay.Path)
+
+	atomic.StoreInt32(&s.loaded, 1)
+	go s.replay(ctx, results, cfg.Replay.Speed)
+
+	return s, nil
+}
+
+// replay feeds results in timestamp order, sleeping between them according to speed (0 = no delay)
+func (s *replayStrategy) replay(ctx context.Context, results []*measurement.Result, speed float64) {
+	for i, r := range results {
+		if speed > 0 && i > 0 {
+			gap := time.Duration(float64(r.Timestamp()-results[i-1].Timestamp()) * float64(time.Second) / speed)
+			if gap > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(gap):
+				}
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.processMeasurementResult(r)
+	}
+
+	log.Infof("Replay finished after %d results", len(results))
+}
+
+func (s *replayStrategy) processMeasurementResult(r *measurement.Result) {
+	log.Debugf("Replaying result for %d from probe %d", r.MsmId(), r.PrbId())
+
+	LastDataTimestampGauge.WithLabelValues(strconv.Itoa(r.MsmId())).Set(float64(time.Now().Unix()))
+
+	p, err := s.probeForID(r.PrbId())
+	if err != nil {
+		log.Errorf("%v, using placeholder", err)
+		p = probe.NewPlaceholder(r.PrbId())
+		DegradedResultsCounter.WithLabelValues(strconv.Itoa(r.MsmId())).Inc()
+	}
+
+	s.add(r, p)
+}
+
+func (s *replayStrategy) probeForID(id int) (*probe.Probe, error) {
+	if s.probes == nil {
+		return probeForID(s.ctx, id)
+	}
+
+	if p, found := s.probes[id]; found {
+		return p, nil
+	}
+
+	log.Debugf("Probe %d not found in probes file, using probe without metadata", id)
+	return probe.NewPlaceholder(id), nil
+}
+
+func (s *replayStrategy) add(m *measurement.Result, probe *probe.Probe) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msm := strconv.Itoa(m.MsmId())
+
+	mes, found := s.measurements[msm]
+	if !found {
+		var err error
+		mes, err = measurementForType(m.Type(), msm, strconv.Itoa(m.Af()), s.cfg.SettingsForID(msm))
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		s.measurements[msm] = mes
+	}
+
+	mes.Add(m, probe)
+}
+
+func (s *replayStrategy) MeasurementResults(ctx context.Context, ids []string) ([]*exporter.Measurement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*exporter.Measurement, 0)
+	for _, id := range ids {
+		if m, found := s.measurements[id]; found {
+			result = append(result, m)
+		}
+	}
+
+	return result, nil
+}
+
+// MeasurementStatus returns the state of the results replayed for a measurement
+func (s *replayStrategy) MeasurementStatus(id string) MeasurementStatus {
+	s.mu.Lock()
+	mes := s.measurements[id]
+	s.mu.Unlock()
+
+	st := MeasurementStatus{}
+	if mes == nil {
+		return st
+	}
+
+	stats := mes.Stats()
+	st.Probes = mes.ProbeCount()
+	st.Type = stats.Type
+	st.AF = stats.AF
+	st.Dropped = stats.Dropped
+
+	return st
+}
+
+func (s *replayStrategy) IsHealthy() bool {
+	return atomic.LoadInt32(&s.loaded) == 1
+}
+
+// readReplayResults reads all results from a file or all files in a directory (recursively) ordered by timestamp.
+// Files written by the recorder (gzip compressed or not) can be replayed as they are.
+func readReplayResults(path string) ([]*measurement.Result, error) {
+	files, err := replayFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*measurement.Result, 0)
+	for _, f := range files {
+		err := readJSONLines(f, func(line []byte) error {
+			r := &measurement.Result{}
+			if err := json.Unmarshal(line, r); err != nil {
+				return err
+			}
+
+			results = append(results, r)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Timestamp() < results[j].Timestamp()
+	})
+
+	return results, nil
+}
+
+func replayFiles(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+
+	files := make([]string, 0)
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && (strings.HasSuffix(d.Name(), ".jsonl") || strings.HasSuffix(d.Name(), ".jsonl.gz")) {
+			files = append(files, p)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func readProbesFile(path string) (map[int]*probe.Probe, error) {
+	probes := make(map[int]*probe.Probe)
+
+	err := readJSONLines(path, func(line []byte) error {
+		p, err := probe.FromJSON(line)
+		if err != nil {
+			return err
+		}
+
+		probes[p.ID] = p
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return probes, nil
+}
+
+// readJSONLines calls f for every non empty line of the file. Lines which can not be processed are logged and skipped.
+func readJSONLines(path string, f func(line []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	if !strings.HasSuffix(path, ".gz") {
+		return scanJSONLines(path, file, f)
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", path, err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	return scanJSONLines(path, gz, f)
+}
+
+func scanJSONLines(name string, r io.Reader, f func(line []byte) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxReplayLineSize)
+
+	n := 0
+	for sc.Scan() {
+		n++
+		line := sc.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		if err := f(line); err != nil {
+			log.Errorf("could not process line %d of %s: %v", n, name, err)
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("could not read %s: %w", name, err)
+	}
+
+	return nil
+}
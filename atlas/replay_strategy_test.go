@@ -0,0 +1,107 @@
+package atlas
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const (
+	replayPingLine1  = `{"af":4,"prb_id":1,"result":[{"rtt":10.1},{"rtt":11.2}],"ttl":55,"avg":10.65,"size":48,"timestamp":1700000100,"type":"ping","sent":2,"rcvd":2,"msm_id":1001,"dst_addr":"8.8.8.8","dst_name":"8.8.8.8","min":10.1,"max":11.2}`
+	replayPingLine2  = `{"af":4,"prb_id":2,"result":[{"rtt":20.1},{"x":"*"}],"ttl":55,"avg":20.1,"size":48,"timestamp":1700000000,"type":"ping","sent":2,"rcvd":1,"msm_id":1001,"dst_addr":"8.8.8.8","dst_name":"8.8.8.8","min":20.1,"max":20.1}`
+	replayProbeLines = `{"id":1,"asn_v4":3320,"country_code":"DE","geometry":{"coordinates":[13.4,52.5]}}
+{"id":2,"asn_v4":680,"country_code":"DE","geometry":{"coordinates":[8.6,50.1]}}
+`
+)
+
+func writeReplayFixtures(t *testing.T) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	resultDir := filepath.Join(dir, "results", "1001")
+	if err := os.MkdirAll(resultDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		filepath.Join(resultDir, "a.jsonl"):   replayPingLine1 + "\n\n",
+		filepath.Join(resultDir, "other.txt"): "ignored",
+		filepath.Join(dir, "probes.jsonl"):    replayProbeLines,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// recorder output is gzip compressed by default
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write([]byte(replayPingLine2 + "\n{not json}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(resultDir, "b.jsonl.gz"), buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, "results"), filepath.Join(dir, "probes.jsonl")
+}
+
+func TestReadReplayResults_OrderedByTimestamp(t *testing.T) {
+	path, _ := writeReplayFixtures(t)
+
+	results, err := readReplayResults(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].PrbId() != 2 || results[1].PrbId() != 1 {
+		t.Fatalf("expected results ordered by timestamp, got probes %d, %d", results[0].PrbId(), results[1].PrbId())
+	}
+}
+
+func TestReplayStrategy_AllAtOnce(t *testing.T) {
+	path, probesFile := writeReplayFixtures(t)
+
+	cfg := &config.Config{}
+	cfg.Replay.Path = path
+	cfg.Replay.ProbesFile = probesFile
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := NewReplayStrategy(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsHealthy() {
+		t.Fatalf("expected healthy after loading results")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		res, err := s.MeasurementResults(ctx, []string{"1001"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) == 1 && testutil.CollectAndCount(res[0], "atlas_ping_success") == 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected measurement 1001 with results of 2 probes after replay")
+}
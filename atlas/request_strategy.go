@@ -6,7 +6,10 @@ import (
 	"context"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/czerwonk/atlas_exporter/api"
 	"github.com/czerwonk/atlas_exporter/exporter"
 
 	"github.com/DNS-OARC/ripeatlas"
@@ -15,19 +18,82 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// apiHealth tracks the results of requests for measurement results
+type apiHealth struct {
+	lastSuccess atomic.Int64
+	lastFailure atomic.Int64
+}
+
+// requestHealth is shared by all request strategies, so it is kept when the strategy is replaced on reload
+var requestHealth = newAPIHealth()
+
+func newAPIHealth() *apiHealth {
+	h := &apiHealth{}
+	h.lastSuccess.Store(time.Now().UnixNano())
+	return h
+}
+
+func (h *apiHealth) success() {
+	h.lastSuccess.Store(time.Now().UnixNano())
+}
+
+func (h *apiHealth) failure() {
+	h.lastFailure.Store(time.Now().UnixNano())
+}
+
+// healthy returns false if the last request failed and no request succeeded within maxAge (0 = always healthy)
+func (h *apiHealth) healthy(maxAge time.Duration) bool {
+	if maxAge == 0 {
+		return true
+	}
+
+	success, failure := h.lastSuccess.Load(), h.lastFailure.Load()
+	if failure <= success {
+		return true
+	}
+
+	return time.Since(time.Unix(0, success)) <= maxAge
+}
+
 type requestStrategy struct {
-	atlasser ripeatlas.Atlaser
+	client   *api.Client
 	workers  uint
 	cfg      *config.Config
+	registry *Registry
+}
+
+// RequestStrategyOpt are options to apply to the request strategy
+type RequestStrategyOpt func(s *requestStrategy)
+
+// WithRequestRegistry resolves settings of measurements (e.g. API keys) using the registry
+// instead of the measurements configured in the config
+func WithRequestRegistry(r *Registry) RequestStrategyOpt {
+	return func(s *requestStrategy) {
+		s.registry = r
+	}
 }
 
 // NewRequestStrategy returns an strategy to retrieve data from Atlas API using requests
-func NewRequestStrategy(cfg *config.Config, workers uint) Strategy {
-	return requestStrategy{
-		atlasser: ripeatlas.Atlaser(ripeatlas.NewHttp()),
-		cfg:      cfg,
-		workers:  workers,
+func NewRequestStrategy(cfg *config.Config, workers uint, opts ...RequestStrategyOpt) Strategy {
+	s := requestStrategy{
+		client:  client,
+		cfg:     cfg,
+		workers: workers,
+	}
+
+	for _, opt := range opts {
+		opt(&s)
 	}
+
+	return s
+}
+
+func (s *requestStrategy) apiKeyFor(id string) config.Secret {
+	if s.registry != nil {
+		return s.registry.APIKeyFor(s.cfg, id)
+	}
+
+	return s.cfg.APIKeyFor(id)
 }
 
 func (s requestStrategy) MeasurementResults(ctx context.Context, ids []string) ([]*exporter.Measurement, error) {
@@ -60,57 +126,112 @@ func (s requestStrategy) MeasurementResults(ctx context.Context, ids []string) (
 	}
 }
 
+func (s *requestStrategy) settingsFor(id string) config.MeasurementSettings {
+	if s.registry != nil {
+		return s.registry.SettingsFor(s.cfg, id)
+	}
+
+	return s.cfg.SettingsForID(id)
+}
+
 func (s *requestStrategy) getMeasurementForID(ctx context.Context, id string, ch chan<- *exporter.Measurement, wg *sync.WaitGroup) {
 	defer wg.Done()
+
+	settings := s.settingsFor(id)
+	if settings.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.Timeout)
+		defer cancel()
+	}
+
+	resCh := make(chan *exporter.Measurement, 1)
+	go func() {
+		resCh <- s.measurementForID(ctx, id, settings)
+	}()
+
+	select {
+	case mes := <-resCh:
+		if mes == nil {
+			return
+		}
+
+		select {
+		case ch <- mes:
+		case <-ctx.Done():
+		}
+	case <-ctx.Done():
+		log.Errorf("could not retrieve measurement results for %s within %v", id, settings.Timeout)
+	}
+}
+
+func (s *requestStrategy) measurementForID(ctx context.Context, id string, settings config.MeasurementSettings) (mes *exporter.Measurement) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Errorf("Panic getting measurement %s: %v", id, r)
 			// Measurement will be skipped for this scrape
+			mes = nil
 		}
 	}()
 
-	resultCh, err := s.atlasser.MeasurementLatest(ripeatlas.Params{"pk": id})
+	resultCh, err := s.client.WithKey(s.apiKeyFor(id)).WithContext(ctx).MeasurementLatest(ripeatlas.Params{"pk": id})
 	if err != nil {
 		log.Errorf("could not retrieve measurement results for %s: %v", id, err)
-		return
+		requestHealth.failure()
+		return nil
 	}
 
 	res := []*measurement.Result{}
+	parseErrors := 0
 	for m := range resultCh {
 		if m.ParseError != nil {
 			log.Errorf("failed parsing measurement result for %s: %v", id, m.ParseError)
-			return
+			exporter.ResultsDroppedCounter.WithLabelValues(id, "", "parse_error").Inc()
+			parseErrors++
+			continue
 		}
 
 		res = append(res, m)
 	}
 
-	if len(res) == 0 {
-		return
+	// a response without any parsable result (e.g. an error page) is not a successful request
+	if parseErrors > 0 && len(res) == 0 {
+		requestHealth.failure()
+		return nil
 	}
+	requestHealth.success()
 
-	first := res[0]
-	mes, err := measurementForType(first.Type(), id, strconv.Itoa(first.Af()), s.cfg)
-	if err != nil {
-		log.Errorln(err)
-		return
+	if len(res) == 0 {
+		return nil
 	}
 
-	probes, err := probesForResults(res, s.workers)
+	first := res[0]
+	mes, err = measurementForType(first.Type(), id, strconv.Itoa(first.Af()), settings)
 	if err != nil {
 		log.Errorln(err)
-		return
+		return nil
 	}
 
+	probes := probesForResults(ctx, res, s.workers, s.cfg.Probes.BatchSize)
 	for _, r := range res {
-		mes.Add(r, probes[r.PrbId()])
+		p := probes[r.PrbId()]
+		if p.Placeholder {
+			DegradedResultsCounter.WithLabelValues(id).Inc()
+		}
+
+		mes.Add(r, p)
 	}
 
-	ch <- mes
+	return mes
 }
 
+// IsHealthy returns false if the last request for measurement results failed and no request succeeded within
+// health.api_success_max_age. Without it the strategy is always healthy, as results are only retrieved on scrape.
 func (s requestStrategy) IsHealthy() bool {
-	// For request strategy, we're optimistic - assume healthy unless actively failing
-	// The actual health is determined by whether API calls succeed when metrics are scraped
+	maxAge := s.cfg.Health.APISuccessMaxAge
+	if !requestHealth.healthy(maxAge) {
+		log.Debugf("Health check failed: no successful API request within %v", maxAge)
+		return false
+	}
+
 	return true
 }
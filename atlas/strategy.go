@@ -4,7 +4,9 @@ package atlas
 
 import (
 	"context"
+	"time"
 
+	"github.com/czerwonk/atlas_exporter/config"
 	"github.com/czerwonk/atlas_exporter/exporter"
 )
 
@@ -15,3 +17,47 @@ type Strategy interface {
 	// IsHealthy returns true if the strategy is healthy and ready to serve metrics
 	IsHealthy() bool
 }
+
+// Reloader is implemented by strategies able to apply a changed configuration without restart
+type Reloader interface {
+	// Reload applies the configuration
+	Reload(cfg *config.Config)
+}
+
+// MeasurementStatus is the runtime state of a measurement
+type MeasurementStatus struct {
+	// Connected is true if the measurement is subscribed on a connected stream
+	Connected bool `json:"connected"`
+	// LastData is the time the last result was received (nil if none)
+	LastData *time.Time `json:"last_data,omitempty"`
+	// Probes is the number of probes results are held for
+	Probes int `json:"probes"`
+	// RetryAttempt is the number of failed connection attempts since the last successful one
+	RetryAttempt int `json:"retry_attempt"`
+	// Type is the type of the results received (empty if none)
+	Type string `json:"type,omitempty"`
+	// AF is the address family of the results received (0 if none)
+	AF int `json:"af,omitempty"`
+	// Dropped is the number of results dropped by reason (e.g. invalid, duplicate)
+	Dropped map[string]int `json:"dropped,omitempty"`
+	// LastError is the last error subscribing or retrieving results (nil if none)
+	LastError *StatusError `json:"last_error,omitempty"`
+}
+
+// StatusError is an error which occurred for a measurement
+type StatusError struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// QueueReporter is implemented by strategies queueing results before processing them
+type QueueReporter interface {
+	// QueueLength returns the number of results waiting to be processed
+	QueueLength() int
+}
+
+// StatusReporter is implemented by strategies reporting the runtime state of measurements
+type StatusReporter interface {
+	// MeasurementStatus returns the state of a measurement
+	MeasurementStatus(id string) MeasurementStatus
+}
@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package atlas
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/czerwonk/atlas_exporter/config"
+	gosocketio "github.com/graarh/golang-socketio"
+)
+
+// streamResult is a measurement result received from the Streaming API along with its raw JSON
+type streamResult struct {
+	*measurement.Result
+	raw json.RawMessage
+	// backfill is set for results retrieved from the REST API, which might be held already
+	backfill bool
+}
+
+// streamConn is a connection to the RIPE Atlas Streaming API. In contrast to the ripeatlas bindings
+// the raw JSON of every result is kept (e.g. for recording) and the connection can be closed by the caller.
+type streamConn struct {
+	client   *gosocketio.Client
+	results  chan *streamResult
+	done     chan struct{}
+	doneOnce sync.Once
+	mu       sync.Mutex
+	closed   bool
+}
+
+// streamEvents are called for subscription events of a connection. Both are optional.
+type streamEvents struct {
+	// subscribed is called when the subscription of a measurement was confirmed
+	subscribed func(msm int)
+	// failed is called for errors reported by the Streaming API. msm is 0 if the error could not be assigned
+	// to a measurement of the connection.
+	failed func(msm int, err error)
+}
+
+// dialStream connects to the Streaming API configured in cfg and subscribes to results of the given measurements.
+// Errors reported by the Streaming API (e.g. for a measurement not existing) are passed to ev and do not close
+// the connection, so other measurements subscribed on it are not affected.
+func dialStream(cfg *config.Config, msms []int, ev streamEvents) (*streamConn, error) {
+	t, err := newStreamTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := gosocketio.Dial(cfg.Atlas.StreamURL, t)
+	if err != nil {
+		return nil, fmt.Errorf("gosocketio.Dial(%s): %w", cfg.Atlas.StreamURL, err)
+	}
+
+	s := &streamConn{
+		client:  c,
+		results: make(chan *streamResult),
+		done:    make(chan struct{}),
+	}
+
+	err = c.On("atlas_error", func(h *gosocketio.Channel, args any) {
+		if ev.failed != nil {
+			ev.failed(eventMeasurement(args, msms), fmt.Errorf("atlas_error: %v", args))
+		}
+	})
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("c.On(atlas_error): %w", err)
+	}
+
+	err = c.On("atlas_subscribed", func(h *gosocketio.Channel, args any) {
+		if msm := eventMeasurement(args, msms); msm != 0 && ev.subscribed != nil {
+			ev.subscribed(msm)
+		}
+	})
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("c.On(atlas_subscribed): %w", err)
+	}
+
+	err = c.On("atlas_result", func(h *gosocketio.Channel, raw json.RawMessage) {
+		r := &streamResult{Result: &measurement.Result{}, raw: raw}
+		if err := json.Unmarshal(raw, r.Result); err != nil {
+			r.ParseError = err
+		}
+		s.send(r)
+	})
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("c.On(atlas_result): %w", err)
+	}
+
+	err = c.On(gosocketio.OnDisconnection, func(h *gosocketio.Channel) {
+		s.close()
+	})
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("c.On(disconnect): %w", err)
+	}
+
+	err = c.On(gosocketio.OnConnection, func(h *gosocketio.Channel) {
+		for _, msm := range msms {
+			subscribe := map[string]any{
+				"stream_type": "result",
+				"msm":         msm,
+			}
+
+			if err := h.Emit("atlas_subscribe", subscribe); err != nil {
+				s.send(&streamResult{Result: &measurement.Result{ParseError: fmt.Errorf("h.Emit(atlas_subscribe): %w", err)}})
+				c.Close()
+				return
+			}
+		}
+	})
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("c.On(connect): %w", err)
+	}
+
+	return s, nil
+}
+
+// eventMeasurement returns the measurement of msms an event refers to, e.g. {"msm": 1001, ...} or an error message
+// mentioning a single measurement of the connection. Returns 0 if no measurement was found.
+func eventMeasurement(args any, msms []int) int {
+	if m, ok := args.(map[string]any); ok {
+		for _, key := range []string{"msm", "msm_id"} {
+			if msm := measurementValue(m[key], msms); msm != 0 {
+				return msm
+			}
+		}
+
+		// e.g. the subscription parameters passed along with the error
+		for _, v := range m {
+			if msm := eventMeasurement(v, msms); msm != 0 {
+				return msm
+			}
+		}
+
+		return 0
+	}
+
+	found := 0
+	for _, field := range strings.FieldsFunc(fmt.Sprint(args), func(r rune) bool { return r < '0' || r > '9' }) {
+		msm := measurementValue(field, msms)
+		if msm == 0 || msm == found {
+			continue
+		}
+
+		if found != 0 {
+			// ambiguous
+			return 0
+		}
+		found = msm
+	}
+
+	return found
+}
+
+// measurementValue returns the measurement of msms with ID v (number or string), 0 if v is none of msms
+func measurementValue(v any, msms []int) int {
+	var msm int
+	switch v := v.(type) {
+	case float64:
+		msm = int(v)
+	case string:
+		msm, _ = strconv.Atoi(v)
+	default:
+		return 0
+	}
+
+	if !slices.Contains(msms, msm) {
+		return 0
+	}
+
+	return msm
+}
+
+// Results returns the channel results are sent to. The channel is closed on disconnect.
+func (s *streamConn) Results() <-chan *streamResult {
+	return s.results
+}
+
+// Close closes the connection
+func (s *streamConn) Close() {
+	s.doneOnce.Do(func() { close(s.done) })
+	s.client.Close()
+	s.close()
+}
+
+func (s *streamConn) send(r *streamResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.results <- r:
+	case <-s.done:
+	}
+}
+
+func (s *streamConn) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	close(s.results)
+	s.closed = true
+}
@@ -0,0 +1,174 @@
+package atlas
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/config"
+	gosocketio "github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/transport"
+)
+
+func TestDialStream_MultipleMeasurements(t *testing.T) {
+	srv := gosocketio.NewServer(transport.GetDefaultWebsocketTransport())
+	err := srv.On("atlas_subscribe", func(c *gosocketio.Channel, args map[string]any) {
+		_ = c.Emit("atlas_result", map[string]any{"msm_id": args["msm"], "prb_id": 1, "type": "ping", "timestamp": 1700000000})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	cfg := &config.Config{}
+	cfg.Atlas.StreamURL = "ws://" + strings.TrimPrefix(hs.URL, "http://") + "/socket.io/?EIO=3&transport=websocket"
+
+	conn, err := dialStream(cfg, []int{1001, 1002}, streamEvents{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	got := make(map[int]bool)
+	timeout := time.After(5 * time.Second)
+	for len(got) < 2 {
+		select {
+		case r := <-conn.Results():
+			if r.ParseError != nil {
+				t.Fatal(r.ParseError)
+			}
+			if len(r.raw) == 0 {
+				t.Fatalf("expected raw JSON of result for %d", r.MsmId())
+			}
+			got[r.MsmId()] = true
+		case <-timeout:
+			t.Fatalf("expected results of both measurements over one connection, got %v", got)
+		}
+	}
+
+	if !got[1001] || !got[1002] {
+		t.Fatalf("expected results of measurements 1001 and 1002, got %v", got)
+	}
+}
+
+func TestDialStream_MeasurementError(t *testing.T) {
+	srv := gosocketio.NewServer(transport.GetDefaultWebsocketTransport())
+	err := srv.On("atlas_subscribe", func(c *gosocketio.Channel, args map[string]any) {
+		if args["msm"].(float64) == 1002 {
+			_ = c.Emit("atlas_error", map[string]any{"message": "measurement not found", "msm": 1002})
+			return
+		}
+
+		_ = c.Emit("atlas_subscribed", args)
+		_ = c.Emit("atlas_result", map[string]any{"msm_id": args["msm"], "prb_id": 1, "type": "ping", "timestamp": 1700000000})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	cfg := &config.Config{}
+	cfg.Atlas.StreamURL = "ws://" + strings.TrimPrefix(hs.URL, "http://") + "/socket.io/?EIO=3&transport=websocket"
+
+	subscribed := make(chan int, 2)
+	failed := make(chan int, 2)
+	conn, err := dialStream(cfg, []int{1001, 1002}, streamEvents{
+		subscribed: func(msm int) { subscribed <- msm },
+		failed:     func(msm int, err error) { failed <- msm },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	timeout := time.After(5 * time.Second)
+	var gotSubscribed, gotFailed, gotResult bool
+	for !gotSubscribed || !gotFailed || !gotResult {
+		select {
+		case msm := <-subscribed:
+			if msm != 1001 {
+				t.Fatalf("expected subscription of 1001 to be confirmed, got %d", msm)
+			}
+			gotSubscribed = true
+		case msm := <-failed:
+			if msm != 1002 {
+				t.Fatalf("expected error of 1002, got %d", msm)
+			}
+			gotFailed = true
+		case r, ok := <-conn.Results():
+			if !ok {
+				t.Fatalf("expected connection to be kept open on error of a single measurement")
+			}
+			gotResult = gotResult || r.MsmId() == 1001
+		case <-timeout:
+			t.Fatalf("expected confirmation of 1001, error of 1002 and result of 1001")
+		}
+	}
+}
+
+func TestEventMeasurement(t *testing.T) {
+	msms := []int{1001, 1002}
+
+	tests := []struct {
+		args     any
+		expected int
+	}{
+		{args: map[string]any{"msm": float64(1002)}, expected: 1002},
+		{args: map[string]any{"params": map[string]any{"msm": "1001"}}, expected: 1001},
+		{args: "Measurement 1002 does not exist", expected: 1002},
+		{args: "Measurements 1001 and 1002 do not exist", expected: 0},
+		{args: map[string]any{"msm": float64(2001)}, expected: 0},
+		{args: "internal error", expected: 0},
+	}
+
+	for _, tc := range tests {
+		if got := eventMeasurement(tc.args, msms); got != tc.expected {
+			t.Fatalf("%v: expected %d, got %d", tc.args, tc.expected, got)
+		}
+	}
+}
+
+func TestPartitionMeasurements(t *testing.T) {
+	ms := []config.Measurement{{ID: "1"}, {ID: "2"}, {ID: "3"}, {ID: "4"}, {ID: "5"}}
+
+	tests := []struct {
+		n     uint
+		parts int
+	}{
+		{n: 0, parts: 5},
+		{n: 1, parts: 1},
+		{n: 2, parts: 2},
+		{n: 10, parts: 5},
+	}
+
+	for _, tc := range tests {
+		parts := partitionMeasurements(ms, tc.n)
+		if len(parts) > tc.parts || (tc.n <= 1 && len(parts) != tc.parts) {
+			t.Fatalf("n=%d: expected %d connections, got %d", tc.n, tc.parts, len(parts))
+		}
+
+		total := 0
+		for _, p := range parts {
+			total += len(p)
+		}
+		if total != len(ms) {
+			t.Fatalf("n=%d: expected %d measurements, got %d", tc.n, len(ms), total)
+		}
+	}
+
+	// adding a measurement must not move others to a different connection
+	before := partitionMeasurements(ms, 2)
+	after := partitionMeasurements(append(ms, config.Measurement{ID: "6"}), 2)
+	for key, p := range before {
+		for i, m := range p {
+			if after[key][i].ID != m.ID {
+				t.Fatalf("measurement %s moved to another connection", m.ID)
+			}
+		}
+	}
+}
@@ -4,6 +4,9 @@ package atlas
 
 import (
 	"context"
+	"hash/fnv"
+	"reflect"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -11,51 +14,275 @@ import (
 
 	"github.com/czerwonk/atlas_exporter/exporter"
 	"github.com/czerwonk/atlas_exporter/probe"
+	"github.com/czerwonk/atlas_exporter/record"
 
 	"github.com/DNS-OARC/ripeatlas/measurement"
 	"github.com/czerwonk/atlas_exporter/config"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// placeholderRefreshInterval is the interval to retry retrieving probes results are held with a placeholder for
+	placeholderRefreshInterval = time.Minute
+
+	// expireInterval is the interval to remove results older than the retention
+	expireInterval = time.Minute
+)
+
 type streamingStrategy struct {
+	ctx              context.Context
 	measurements     map[string]*exporter.Measurement
+	settings         map[string]config.MeasurementSettings
+	lastData         map[string]time.Time
+	lastErr          map[string]StatusError
 	cfg              *config.Config
+	cfgMu            sync.RWMutex
+	recorder         *record.Recorder
+	registry         *Registry
+	probes           *probeBatcher
+	resultCh         chan *streamResult
 	mu               sync.Mutex
-	connectedWorkers int32
+	workers          map[string]*streamStrategyWorker
+	workersMu        sync.Mutex
 	lastDataTime     int64
+	fetchingMetadata atomic.Bool
+}
+
+// StreamingStrategyOpt are options to apply to the streaming strategy
+type StreamingStrategyOpt func(s *streamingStrategy)
+
+// WithRecorder archives every streamed result using the recorder
+func WithRecorder(r *record.Recorder) StreamingStrategyOpt {
+	return func(s *streamingStrategy) {
+		s.recorder = r
+	}
+}
+
+// WithRegistry subscribes to the measurements of the registry, following changes of the set.
+// Without registry the measurements configured in the config are subscribed.
+func WithRegistry(r *Registry) StreamingStrategyOpt {
+	return func(s *streamingStrategy) {
+		s.registry = r
+	}
 }
 
 // NewStreamingStrategy returns an strategy using the RIPE Atlas Streaming API
-func NewStreamingStrategy(ctx context.Context, cfg *config.Config, bufferSize uint) Strategy {
+func NewStreamingStrategy(ctx context.Context, cfg *config.Config, bufferSize uint, opts ...StreamingStrategyOpt) Strategy {
 	s := &streamingStrategy{
+		ctx:          ctx,
 		cfg:          cfg,
 		measurements: make(map[string]*exporter.Measurement),
+		settings:     make(map[string]config.MeasurementSettings),
+		lastData:     make(map[string]time.Time),
+		lastErr:      make(map[string]StatusError),
+		workers:      make(map[string]*streamStrategyWorker),
+		resultCh:     make(chan *streamResult, int(bufferSize)),
+		probes:       newProbeBatcher(ctx, cfg.Probes.BatchSize, cfg.Probes.BatchWindow),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.registry == nil {
+		s.registry = NewRegistry(cfg)
 	}
 
-	s.start(ctx, cfg.Measurements, bufferSize)
+	go s.processMeasurementResults(s.resultCh)
+	go s.refreshPlaceholders(ctx)
+	go s.expireResults(ctx)
+
+	s.reconcile(s.registry.Active())
+	s.registry.OnChange(func(ms []config.Measurement) {
+		s.reconcile(ms)
+		s.rebuildMeasurements()
+	})
+
 	return s
 }
 
-func (s *streamingStrategy) start(ctx context.Context, measurements []config.Measurement, bufferSize uint) {
-	resultCh := make(chan *measurement.Result, int(bufferSize))
+func (s *streamingStrategy) config() *config.Config {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
 
-	for _, m := range measurements {
-		w := &streamStrategyWorker{
-			resultCh:    resultCh,
-			measurement: m,
-			strategy:    s,
-		}
-		go func() {
-			if err := w.run(ctx); err != nil {
-				log.Errorf("Worker error for measurement %s: %v", m.ID, err)
+	return s.cfg
+}
+
+// Reload applies a changed configuration. Measurements whose settings changed are rebuilt
+// keeping the results held, connections are only restarted if the assignment of measurements changed.
+func (s *streamingStrategy) Reload(cfg *config.Config) {
+	s.cfgMu.Lock()
+	old := s.cfg
+	s.cfg = cfg
+	s.cfgMu.Unlock()
+
+	s.rebuildMeasurements()
+
+	if old.Streaming.Connections != cfg.Streaming.Connections {
+		s.reconcile(s.registry.Active())
+	}
+}
+
+// rebuildMeasurements rebuilds the measurements whose settings changed
+func (s *streamingStrategy) rebuildMeasurements() {
+	cfg := s.config()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rebuilt := 0
+	for id, mes := range s.measurements {
+		settings := s.registry.SettingsFor(cfg, id)
+		if reflect.DeepEqual(settings, s.settings[id]) {
+			continue
+		}
+
+		nm, err := rebuildMeasurement(id, mes, settings)
+		if err != nil {
+			log.Errorf("could not rebuild measurement %s: %v", id, err)
+			continue
+		}
+
+		if nm == nil {
+			delete(s.measurements, id)
+			delete(s.settings, id)
+			continue
+		}
+
+		s.measurements[id] = nm
+		s.settings[id] = settings
+		rebuilt++
+	}
+
+	if rebuilt > 0 {
+		log.Infof("Rebuilt %d measurements using changed settings", rebuilt)
+	}
+}
+
+// reconcile starts and stops connections so exactly the given measurements are subscribed.
+// Connections whose set of measurements did not change are left untouched.
+func (s *streamingStrategy) reconcile(measurements []config.Measurement) {
+	s.workersMu.Lock()
+	defer s.workersMu.Unlock()
+
+	parts := partitionMeasurements(measurements, s.config().Streaming.Connections)
+	stopping := make([]*streamStrategyWorker, 0)
+	starting := make([]*streamStrategyWorker, 0)
+
+	for key, old := range s.workers {
+		ms, found := parts[key]
+		delete(parts, key)
+
+		if found && sameSubscriptions(ms, old.measurements) {
+			continue
+		}
+
+		stopping = append(stopping, old)
+		delete(s.workers, key)
+
+		if found {
+			w := s.newWorker(ms)
+			s.workers[key] = w
+			starting = append(starting, w)
+		}
+	}
+
+	for key, ms := range parts {
+		w := s.newWorker(ms)
+		s.workers[key] = w
+		starting = append(starting, w)
+	}
+
+	if len(stopping) == 0 {
+		for _, w := range starting {
+			w.start()
+		}
+		return
+	}
+
+	go s.replaceWorkers(stopping, starting)
+}
+
+func (s *streamingStrategy) newWorker(measurements []config.Measurement) *streamStrategyWorker {
+	ctx, cancel := context.WithCancel(s.ctx)
+
+	return &streamStrategyWorker{
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+		resultCh:     s.resultCh,
+		measurements: measurements,
+		strategy:     s,
+		started:      time.Now(),
+	}
+}
+
+// replaceWorkers stops the old workers before starting their successors, so measurements moved to
+// another connection are never reported disconnected while subscribed. State of measurements no longer
+// subscribed at all is removed.
+func (s *streamingStrategy) replaceWorkers(stopping, starting []*streamStrategyWorker) {
+	for _, w := range stopping {
+		w.stop()
+	}
+
+	for _, w := range stopping {
+		for _, m := range w.measurements {
+			if _, found := s.registry.Get(m.ID); !found {
+				log.Infof("Unsubscribed from results of measurement #%s", m.ID)
+				s.removeMeasurement(m.ID)
 			}
-		}()
+		}
+	}
+
+	for _, w := range starting {
+		w.start()
+	}
+}
+
+func (s *streamingStrategy) removeMeasurement(id string) {
+	s.mu.Lock()
+	delete(s.measurements, id)
+	delete(s.settings, id)
+	delete(s.lastData, id)
+	delete(s.lastErr, id)
+	s.mu.Unlock()
+
+	StreamConnectedGauge.DeleteLabelValues(id)
+	LastDataTimestampGauge.DeleteLabelValues(id)
+}
+
+// sameSubscriptions returns true if both sets subscribe the same measurements. The stream is subscribed without
+// API key, so other settings of measurements (including the API key) do not affect connections.
+func sameSubscriptions(a, b []config.Measurement) bool {
+	return slices.EqualFunc(a, b, func(x, y config.Measurement) bool {
+		return x.ID == y.ID
+	})
+}
+
+// partitionMeasurements assigns the measurements to n connections, with n = 0 every measurement gets a connection on its own.
+// Measurements are assigned by hash of their ID, so adding or removing a measurement only affects one connection.
+func partitionMeasurements(measurements []config.Measurement, n uint) map[string][]config.Measurement {
+	parts := make(map[string][]config.Measurement)
+	for _, m := range measurements {
+		key := m.ID
+		if n > 0 {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(m.ID))
+			key = "conn-" + strconv.FormatUint(uint64(h.Sum32()%uint32(n)), 10)
+		}
+
+		parts[key] = append(parts[key], m)
 	}
 
-	go s.processMeasurementResults(resultCh)
+	return parts
 }
 
-func (s *streamingStrategy) processMeasurementResults(resultCh chan *measurement.Result) {
+// QueueLength returns the number of results waiting to be processed
+func (s *streamingStrategy) QueueLength() int {
+	return len(s.resultCh)
+}
+
+func (s *streamingStrategy) processMeasurementResults(resultCh chan *streamResult) {
 	for {
 		func() {
 			defer func() {
@@ -84,26 +311,62 @@ func (s *streamingStrategy) processMeasurementResults(resultCh chan *measurement
 	}
 }
 
-func (s *streamingStrategy) processMeasurementResult(r *measurement.Result) {
+func (s *streamingStrategy) processMeasurementResult(r *streamResult) {
 	log.Infof("Got result for %d from probe %d", r.MsmId(), r.PrbId())
 
-	// Update last data time
-	now := time.Now().Unix()
-	atomic.StoreInt64(&s.lastDataTime, now)
+	if r.backfill && s.isHeld(r.Result) {
+		log.Debugf("Skipping backfilled result for %d from probe %d, already held", r.MsmId(), r.PrbId())
+		return
+	}
+
+	if s.recorder != nil && r.raw != nil {
+		if err := s.recorder.Write(r.MsmId(), r.raw); err != nil {
+			log.Errorf("could not record result for %d from probe %d: %v", r.MsmId(), r.PrbId(), err)
+		}
+	}
 
-	// Update metrics
-	measurementID := strconv.Itoa(r.MsmId())
-	LastDataTimestampGauge.WithLabelValues(measurementID).Set(float64(now))
+	if r.ParseError != nil {
+		if r.raw != nil {
+			exporter.ResultReceived(r.Result)
+			exporter.ResultDropped(r.Result, "parse_error")
+		}
+		return
+	}
 
-	probe, err := probeForID(r.PrbId())
-	if err != nil {
-		log.Error(err)
+	// e.g. still queued after the measurement was removed
+	if !s.isRegistered(strconv.Itoa(r.MsmId())) {
+		s.dropUnregistered(r.Result)
 		return
 	}
 
-	s.add(r, probe)
+	measurementID := strconv.Itoa(r.MsmId())
+
+	// only results of the stream prove it delivers data, backfilled results are retrieved from the REST API
+	if !r.backfill {
+		t := time.Now()
+		now := t.Unix()
+		atomic.StoreInt64(&s.lastDataTime, now)
+		LastDataTimestampGauge.WithLabelValues(measurementID).Set(float64(now))
+
+		s.mu.Lock()
+		s.lastData[measurementID] = t
+		s.mu.Unlock()
+	}
+
+	// results are added once the probe is known, lookups of probes not cached are batched
+	s.probes.Lookup(r.PrbId(), func(p *probe.Probe, err error) {
+		if err != nil {
+			log.Errorf("%v, using placeholder", err)
+			p = probe.NewPlaceholder(r.PrbId())
+			DegradedResultsCounter.WithLabelValues(measurementID).Inc()
+		}
+
+		s.add(r.Result, p)
+	})
 }
 
+// add adds the result to its measurement, creating the measurement if needed. Results of measurements
+// no longer registered (e.g. removed while the probe was looked up) are dropped, so they are not created again.
 func (s *streamingStrategy) add(m *measurement.Result, probe *probe.Probe) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -111,23 +374,138 @@ func (s *streamingStrategy) add(m *measurement.Result, probe *probe.Probe) {
 	msm := strconv.Itoa(m.MsmId())
 	log.Debugf("Adding result for measurement ID '%s' (raw MsmId: %d)", msm, m.MsmId())
 
+	// checked holding s.mu, so a measurement removed after the check is removed after the result was added
+	if !s.isRegistered(msm) {
+		s.dropUnregistered(m)
+		return
+	}
+
 	mes, found := s.measurements[msm]
 	if !found {
 		log.Debugf("Creating new measurement object for ID '%s' of type '%s'", msm, m.Type())
+		settings := s.registry.SettingsFor(s.config(), msm)
+
 		var err error
-		mes, err = measurementForType(m.Type(), msm, strconv.Itoa(m.Af()), s.cfg)
+		mes, err = measurementForType(m.Type(), msm, strconv.Itoa(m.Af()), settings)
 		if err != nil {
 			log.Error(err)
 			return
 		}
 
 		s.measurements[msm] = mes
+		s.settings[msm] = settings
 		log.Debugf("Stored measurement ID '%s' in map. Map now has keys: %v", msm, s.getMapKeys())
 	}
 
 	mes.Add(m, probe)
 }
 
+// expireResults periodically removes results older than the retention of their measurement
+func (s *streamingStrategy) expireResults(ctx context.Context) {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			removed := 0
+			for _, mes := range s.measurements {
+				removed += mes.Expire()
+			}
+			s.mu.Unlock()
+
+			if removed > 0 {
+				log.Debugf("Removed %d results older than retention", removed)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshPlaceholders periodically retries to retrieve probes results were added with a placeholder for
+func (s *streamingStrategy) refreshPlaceholders(ctx context.Context) {
+	ticker := time.NewTicker(placeholderRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.refreshPlaceholderProbes()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *streamingStrategy) refreshPlaceholderProbes() {
+	s.mu.Lock()
+	ids := make(map[int]bool)
+	for _, mes := range s.measurements {
+		for _, p := range mes.Probes() {
+			if p.Placeholder {
+				ids[p.ID] = true
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for id := range ids {
+		s.probes.Lookup(id, func(p *probe.Probe, err error) {
+			if err != nil {
+				return
+			}
+
+			s.updateProbe(p)
+		})
+	}
+}
+
+// updateProbe replaces the probe in all measurements
+func (s *streamingStrategy) updateProbe(p *probe.Probe) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, mes := range s.measurements {
+		mes.UpdateProbe(p)
+	}
+}
+
+// isRegistered returns true if the measurement is registered (subscribed or paused)
+func (s *streamingStrategy) isRegistered(id string) bool {
+	_, found := s.registry.Get(id)
+	return found
+}
+
+func (s *streamingStrategy) dropUnregistered(m *measurement.Result) {
+	log.Debugf("Dropping result for %d from probe %d, measurement is not registered", m.MsmId(), m.PrbId())
+	exporter.ResultReceived(m)
+	exporter.ResultDropped(m, "unregistered")
+}
+
+func (s *streamingStrategy) hasMeasurement(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, found := s.measurements[id]
+	return found
+}
+
+// isHeld returns true if the measurement already holds a result of the probe at least as recent as r
+func (s *streamingStrategy) isHeld(r *measurement.Result) bool {
+	s.mu.Lock()
+	mes, found := s.measurements[strconv.Itoa(r.MsmId())]
+	s.mu.Unlock()
+
+	if !found {
+		return false
+	}
+
+	ts, found := mes.LatestTimestamp(r.PrbId())
+	return found && ts >= r.Timestamp()
+}
+
 func (s *streamingStrategy) getMapKeys() []string {
 	keys := make([]string, 0, len(s.measurements))
 	for k := range s.measurements {
@@ -156,16 +534,66 @@ func (s *streamingStrategy) MeasurementResults(ctx context.Context, ids []string
 	return result, nil
 }
 
+// setError records the last error of a measurement reported by its status
+func (s *streamingStrategy) setError(id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastErr[id] = StatusError{Message: err.Error(), Time: time.Now()}
+}
+
+// MeasurementStatus returns the state of the subscription of a measurement
+func (s *streamingStrategy) MeasurementStatus(id string) MeasurementStatus {
+	st := MeasurementStatus{}
+
+	s.mu.Lock()
+	if t, found := s.lastData[id]; found {
+		st.LastData = &t
+	}
+	if e, found := s.lastErr[id]; found {
+		st.LastError = &e
+	}
+	mes := s.measurements[id]
+	s.mu.Unlock()
+
+	if mes != nil {
+		st.Probes = mes.ProbeCount()
+
+		stats := mes.Stats()
+		st.Type = stats.Type
+		st.AF = stats.AF
+		st.Dropped = stats.Dropped
+	}
+
+	s.workersMu.Lock()
+	defer s.workersMu.Unlock()
+
+	for _, w := range s.workers {
+		for _, m := range w.measurements {
+			if m.ID == id {
+				st.Connected = w.isSubscribed(id)
+				st.RetryAttempt = int(w.retryAttempt.Load())
+				return st
+			}
+		}
+	}
+
+	return st
+}
+
+// IsHealthy returns true if enough measurements are subscribed (health.min_connected_percent, at least one) and results
+// are fresh: the last result of any measurement is not older than health.max_data_age and enough measurements
+// received results within health.interval_factor times their interval (health.min_fresh_percent).
 func (s *streamingStrategy) IsHealthy() bool {
-	// Check if we have at least one connected worker
-	connected := atomic.LoadInt32(&s.connectedWorkers)
-	if connected <= 0 {
-		log.Debug("Health check failed: no connected workers")
+	cfg := s.config().Health
+
+	if !s.connectedHealthy(cfg.MinConnectedPercent) {
 		return false
 	}
 
 	// If max data age is configured, also check data freshness
-	if s.cfg.Health.MaxDataAge > 0 {
+	maxDataAge := cfg.MaxDataAge
+	if maxDataAge > 0 {
 		lastData := atomic.LoadInt64(&s.lastDataTime)
 		if lastData == 0 {
 			log.Debug("Health check failed: no data received yet")
@@ -173,11 +601,112 @@ func (s *streamingStrategy) IsHealthy() bool {
 		}
 
 		age := time.Since(time.Unix(lastData, 0))
-		if age > s.cfg.Health.MaxDataAge {
-			log.Debugf("Health check failed: data age %v exceeds max %v", age, s.cfg.Health.MaxDataAge)
+		if age > maxDataAge {
+			log.Debugf("Health check failed: data age %v exceeds max %v", age, maxDataAge)
 			return false
 		}
 	}
 
+	if cfg.IntervalFactor > 0 {
+		return s.freshHealthy(cfg.IntervalFactor, cfg.MinFreshPercent)
+	}
+
+	return true
+}
+
+// connectedHealthy returns true if the subscriptions of at least minPercent of the measurements (at least one)
+// were confirmed on a connected stream
+func (s *streamingStrategy) connectedHealthy(minPercent uint) bool {
+	connected, total := 0, 0
+	s.workersMu.Lock()
+	for _, w := range s.workers {
+		connected += w.subscribedCount()
+		total += len(w.measurements)
+	}
+	s.workersMu.Unlock()
+
+	if connected == 0 {
+		log.Debug("Health check failed: no measurement subscribed")
+		return false
+	}
+
+	if connected*100 < int(minPercent)*total {
+		log.Debugf("Health check failed: %d of %d measurements subscribed, %d%% required", connected, total, minPercent)
+		return false
+	}
+
 	return true
 }
+
+// freshHealthy returns true if at least minPercent of the measurements received a result within factor times
+// their interval (or since they were subscribed). Measurements with unknown interval are not considered,
+// their definitions are retrieved in background.
+func (s *streamingStrategy) freshHealthy(factor float64, minPercent uint) bool {
+	since := make(map[string]time.Time)
+	s.workersMu.Lock()
+	for _, w := range s.workers {
+		for _, m := range w.measurements {
+			since[m.ID] = w.started
+		}
+	}
+	s.workersMu.Unlock()
+
+	s.mu.Lock()
+	for id := range since {
+		if t, found := s.lastData[id]; found {
+			since[id] = t
+		}
+	}
+	s.mu.Unlock()
+
+	known, fresh := 0, 0
+	missing := make([]string, 0)
+	for id, t := range since {
+		m, found := metadataCache.Get(id)
+		if !found {
+			missing = append(missing, id)
+			continue
+		}
+
+		if m.Interval <= 0 {
+			continue
+		}
+
+		known++
+		maxAge := time.Duration(factor * float64(m.Interval) * float64(time.Second))
+		if age := time.Since(t); age <= maxAge {
+			fresh++
+		} else {
+			log.Debugf("Measurement #%s is stale: no result for %v (max. %v)", id, age.Round(time.Second), maxAge)
+		}
+	}
+
+	if len(missing) > 0 {
+		s.fetchMetadata(missing)
+	}
+
+	if fresh*100 < int(minPercent)*known {
+		log.Debugf("Health check failed: %d of %d measurements fresh, %d%% required", fresh, known, minPercent)
+		return false
+	}
+
+	return true
+}
+
+// fetchMetadata retrieves the definitions of the measurements in background, unless already in progress
+func (s *streamingStrategy) fetchMetadata(ids []string) {
+	if client == nil || !s.fetchingMetadata.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer s.fetchingMetadata.Store(false)
+
+		ctx, cancel := context.WithTimeout(s.ctx, s.config().Timeout)
+		defer cancel()
+
+		MeasurementMetadata(ctx, ids, s.config().Worker.Count, func(id string) config.Secret {
+			return s.registry.APIKeyFor(s.config(), id)
+		})
+	}()
+}
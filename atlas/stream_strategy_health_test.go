@@ -1,16 +1,37 @@
 package atlas
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/czerwonk/atlas_exporter/api"
 	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/metadata"
 )
 
+// subscribedWorkers returns a worker per measurement, the first n are subscribed
+func subscribedWorkers(n int, ids ...string) map[string]*streamStrategyWorker {
+	workers := make(map[string]*streamStrategyWorker)
+	for i, id := range ids {
+		w := &streamStrategyWorker{measurements: []config.Measurement{{ID: id}}}
+		w.setSubscribed(id, i < n)
+		workers[id] = w
+	}
+
+	return workers
+}
+
 func TestStreamingIsHealthy_ConnectedNoAge(t *testing.T) {
 	s := &streamingStrategy{cfg: &config.Config{}}
-	atomic.StoreInt32(&s.connectedWorkers, 1)
+	if s.IsHealthy() {
+		t.Fatalf("expected not healthy without subscribed measurement")
+	}
+
+	s.workers = subscribedWorkers(1, "1")
 	if !s.IsHealthy() {
 		t.Fatalf("expected healthy when connected and no age constraint")
 	}
@@ -19,7 +40,7 @@ func TestStreamingIsHealthy_ConnectedNoAge(t *testing.T) {
 func TestStreamingIsHealthy_DataAge(t *testing.T) {
 	s := &streamingStrategy{cfg: &config.Config{}}
 	s.cfg.Health.MaxDataAge = 10 * time.Second
-	atomic.StoreInt32(&s.connectedWorkers, 1)
+	s.workers = subscribedWorkers(1, "1")
 
 	// No data yet -> not healthy
 	if s.IsHealthy() {
@@ -39,3 +60,111 @@ func TestStreamingIsHealthy_DataAge(t *testing.T) {
 		t.Fatalf("expected not healthy with stale data")
 	}
 }
+
+func TestStreamingIsHealthy_ConnectedPercent(t *testing.T) {
+	s := &streamingStrategy{cfg: &config.Config{}, workers: subscribedWorkers(1, "1", "2", "3", "4")}
+	s.cfg.Health.MinConnectedPercent = 50
+
+	if s.IsHealthy() {
+		t.Fatalf("expected not healthy with 1 of 4 measurements subscribed")
+	}
+
+	s.workers["2"].setSubscribed("2", true)
+	if !s.IsHealthy() {
+		t.Fatalf("expected healthy with 2 of 4 measurements subscribed")
+	}
+}
+
+func TestStreamingIsHealthy_IntervalFactor(t *testing.T) {
+	prev := metadataCache
+	defer func() { metadataCache = prev }()
+
+	metadataCache = metadata.NewCache(time.Hour)
+	metadataCache.Add("1001", &api.Measurement{ID: 1001, Interval: 60})
+	metadataCache.Add("1002", &api.Measurement{ID: 1002, Interval: 3600})
+
+	started := time.Now().Add(-10 * time.Minute)
+	s := &streamingStrategy{
+		cfg:      &config.Config{},
+		lastData: map[string]time.Time{"1002": started},
+		workers:  subscribedWorkers(2, "1001", "1002"),
+	}
+	for _, w := range s.workers {
+		w.started = started
+	}
+	s.cfg.Health.IntervalFactor = 3
+	s.cfg.Health.MinFreshPercent = 100
+
+	// no result of 1001 for 10m, 3 intervals are 3m
+	if s.IsHealthy() {
+		t.Fatalf("expected not healthy with stale measurement")
+	}
+
+	s.cfg.Health.MinFreshPercent = 50
+	if !s.IsHealthy() {
+		t.Fatalf("expected healthy with 1 of 2 measurements fresh")
+	}
+
+	s.cfg.Health.MinFreshPercent = 100
+	s.lastData["1001"] = time.Now()
+	if !s.IsHealthy() {
+		t.Fatalf("expected healthy with all measurements fresh")
+	}
+}
+
+func TestRequestIsHealthy_APISuccessMaxAge(t *testing.T) {
+	prev := requestHealth
+	defer func() { requestHealth = prev }()
+
+	requestHealth = newAPIHealth()
+	s := requestStrategy{cfg: &config.Config{}}
+	s.cfg.Health.APISuccessMaxAge = time.Minute
+
+	requestHealth.failure()
+	if !s.IsHealthy() {
+		t.Fatalf("expected healthy with recent success")
+	}
+
+	requestHealth.lastSuccess.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	if s.IsHealthy() {
+		t.Fatalf("expected not healthy without recent success")
+	}
+
+	requestHealth.success()
+	if !s.IsHealthy() {
+		t.Fatalf("expected healthy after success")
+	}
+}
+
+func TestRequestIsHealthy_ParseErrors(t *testing.T) {
+	prev := requestHealth
+	defer func() { requestHealth = prev }()
+
+	body := "<html>maintenance</html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{}
+	cfg.Atlas.APIURL = srv.URL
+	cfg.Health.APISuccessMaxAge = time.Minute
+	c, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestHealth = newAPIHealth()
+	requestHealth.lastSuccess.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	s := &requestStrategy{client: c, cfg: cfg, workers: 1}
+
+	if s.measurementForID(context.Background(), "1001", config.MeasurementSettings{}) != nil || s.IsHealthy() {
+		t.Fatalf("expected response without parsable results to count as failure")
+	}
+
+	body = "[]"
+	s.measurementForID(context.Background(), "1001", config.MeasurementSettings{})
+	if !s.IsHealthy() {
+		t.Fatalf("expected healthy after successful request")
+	}
+}
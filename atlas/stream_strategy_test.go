@@ -0,0 +1,287 @@
+package atlas
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/exporter"
+	"github.com/czerwonk/atlas_exporter/probe"
+	gosocketio "github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStreamingStrategy_FollowsRegistry(t *testing.T) {
+	mu := sync.Mutex{}
+	subscribed := make(map[float64]int)
+
+	srv := gosocketio.NewServer(transport.GetDefaultWebsocketTransport())
+	err := srv.On("atlas_subscribe", func(c *gosocketio.Channel, args map[string]any) {
+		mu.Lock()
+		subscribed[args["msm"].(float64)]++
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	cfg := &config.Config{}
+	cfg.Atlas.StreamURL = "ws://" + strings.TrimPrefix(hs.URL, "http://") + "/socket.io/?EIO=3&transport=websocket"
+	cfg.Measurements = []config.Measurement{{ID: "1001"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := NewRegistry(cfg)
+	s := NewStreamingStrategy(ctx, cfg, 10, WithRegistry(r)).(*streamingStrategy)
+
+	waitFor := func(msg string, f func() bool) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			ok := f()
+			mu.Unlock()
+			if ok {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal(msg)
+	}
+
+	waitFor("expected subscription of 1001", func() bool { return subscribed[1001] == 1 })
+
+	r.Set("discovery", []config.Measurement{{ID: "1002"}})
+	waitFor("expected subscription of 1002", func() bool { return subscribed[1002] == 1 })
+
+	r.Set("discovery", nil)
+	waitFor("expected connection of 1002 to be closed", func() bool {
+		s.workersMu.Lock()
+		defer s.workersMu.Unlock()
+		_, found := s.workers["1002"]
+		return !found
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if subscribed[1001] != 1 {
+		t.Fatalf("expected unchanged connection of 1001 to be kept, got %d subscriptions", subscribed[1001])
+	}
+}
+
+func TestStreamingStrategy_ReloadRebuildsMeasurements(t *testing.T) {
+	cfg := &config.Config{Measurements: []config.Measurement{{ID: "1001"}}}
+	s := &streamingStrategy{
+		cfg:          cfg,
+		measurements: make(map[string]*exporter.Measurement),
+		settings:     make(map[string]config.MeasurementSettings),
+		registry:     NewRegistry(cfg),
+	}
+
+	r := &measurement.Result{}
+	if err := json.Unmarshal([]byte(replayPingLine1), r); err != nil {
+		t.Fatal(err)
+	}
+	s.add(r, &probe.Probe{ID: 1})
+	before := s.measurements["1001"]
+
+	// unchanged measurement options keep measurements
+	unchanged := *cfg
+	unchanged.Health.MaxDataAge = time.Minute
+	s.Reload(&unchanged)
+	if s.measurements["1001"] != before {
+		t.Fatalf("expected measurement to be kept")
+	}
+
+	changed := unchanged
+	changed.HistogramBuckets.Ping.Rtt = []float64{5, 15}
+	s.Reload(&changed)
+
+	after := s.measurements["1001"]
+	if after == before {
+		t.Fatalf("expected measurement to be rebuilt")
+	}
+	if testutil.CollectAndCount(after, "atlas_ping_success") != 1 {
+		t.Fatalf("expected rebuilt measurement to keep held results")
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(after)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "atlas_ping_rtt_hist" && len(mf.GetMetric()[0].GetHistogram().GetBucket()) != 2 {
+			t.Fatalf("expected rebuilt measurement to use changed histogram buckets")
+		}
+	}
+	// overrides of the measurement are applied as well
+	s.registry.Set(SourceConfig, []config.Measurement{{ID: "1001", Labels: map[string]string{"team": "netops"}}})
+	s.rebuildMeasurements()
+
+	reg = prometheus.NewRegistry()
+	reg.MustRegister(s.measurements["1001"])
+	mfs, err = reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			found := false
+			for _, l := range m.GetLabel() {
+				found = found || (l.GetName() == "team" && l.GetValue() == "netops")
+			}
+			if !found {
+				t.Fatalf("expected label team on %s", mf.GetName())
+			}
+		}
+	}
+}
+
+func TestStreamingStrategy_DropsResultsOfRemovedMeasurements(t *testing.T) {
+	cfg := &config.Config{Measurements: []config.Measurement{{ID: "1001"}}}
+	s := &streamingStrategy{
+		cfg:          cfg,
+		measurements: make(map[string]*exporter.Measurement),
+		settings:     make(map[string]config.MeasurementSettings),
+		lastData:     make(map[string]time.Time),
+		lastErr:      make(map[string]StatusError),
+		registry:     NewRegistry(cfg),
+	}
+
+	r := &measurement.Result{}
+	if err := json.Unmarshal([]byte(replayPingLine1), r); err != nil {
+		t.Fatal(err)
+	}
+	s.add(r, &probe.Probe{ID: 1})
+	if !s.hasMeasurement("1001") {
+		t.Fatalf("expected result of registered measurement to be added")
+	}
+
+	s.registry.Remove("1001")
+	s.removeMeasurement("1001")
+
+	// still queued or waiting for the probe lookup
+	s.processMeasurementResult(&streamResult{Result: r})
+	s.add(r, &probe.Probe{ID: 1})
+
+	if s.hasMeasurement("1001") {
+		t.Fatalf("expected removed measurement not to be created again")
+	}
+
+	if _, found := s.lastData["1001"]; found {
+		t.Fatalf("expected no data time for removed measurement")
+	}
+
+	if v := testutil.ToFloat64(exporter.ResultsDroppedCounter.WithLabelValues("1001", "ping", "unregistered")); v != 2 {
+		t.Fatalf("expected 2 results dropped as unregistered, got %v", v)
+	}
+}
+
+func TestStreamingStrategy_BackfilledResultsDoNotUpdateDataTime(t *testing.T) {
+	prev := cache
+	defer func() { cache = prev }()
+
+	cache = probe.NewCache(time.Hour)
+	cache.Add(1, &probe.Probe{ID: 1})
+
+	cfg := &config.Config{Measurements: []config.Measurement{{ID: "1001"}}}
+	s := &streamingStrategy{
+		cfg:          cfg,
+		measurements: make(map[string]*exporter.Measurement),
+		settings:     make(map[string]config.MeasurementSettings),
+		lastData:     make(map[string]time.Time),
+		lastErr:      make(map[string]StatusError),
+		registry:     NewRegistry(cfg),
+		probes:       newProbeBatcher(context.Background(), 1, time.Second),
+	}
+
+	r := &measurement.Result{}
+	if err := json.Unmarshal([]byte(replayPingLine1), r); err != nil {
+		t.Fatal(err)
+	}
+
+	s.processMeasurementResult(&streamResult{Result: r, backfill: true})
+	if !s.isHeld(r) {
+		t.Fatalf("expected backfilled result to be added")
+	}
+	if _, found := s.lastData["1001"]; found || s.lastDataTime != 0 {
+		t.Fatalf("expected backfilled result not to update the data time")
+	}
+
+	s.processMeasurementResult(&streamResult{Result: r})
+	if _, found := s.lastData["1001"]; !found || s.lastDataTime == 0 {
+		t.Fatalf("expected result of the stream to update the data time")
+	}
+}
+
+func TestStreamStrategyWorker_ListenForResultsStopsOnCancel(t *testing.T) {
+	w := &streamStrategyWorker{
+		resultCh:     make(chan *streamResult),
+		measurements: []config.Measurement{{ID: "1001"}},
+	}
+
+	r := &measurement.Result{}
+	if err := json.Unmarshal([]byte(replayPingLine1), r); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan *streamResult, 1)
+	ch <- &streamResult{Result: r}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.listenForResults(ctx, ch)
+		close(done)
+	}()
+
+	// nobody processes results, so the worker blocks sending the result
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected worker to stop while the result channel is full")
+	}
+}
+
+func TestSameSubscriptions(t *testing.T) {
+	a := []config.Measurement{{ID: "1001", APIKey: "old"}, {ID: "1002"}}
+
+	if !sameSubscriptions(a, []config.Measurement{{ID: "1001", APIKey: "new"}, {ID: "1002", Labels: map[string]string{"team": "netops"}}}) {
+		t.Fatalf("expected changes of keys and settings to keep connections, the stream is subscribed without key")
+	}
+
+	if sameSubscriptions(a, []config.Measurement{{ID: "1001"}, {ID: "1003"}}) {
+		t.Fatalf("expected changed measurements to require a new connection")
+	}
+}
+
+func TestStreamQueueLengthCollector(t *testing.T) {
+	s := &streamingStrategy{resultCh: make(chan *streamResult, 3)}
+	c := StreamQueueLengthCollector(s)
+
+	// nobody processes the results
+	s.resultCh <- &streamResult{}
+	s.resultCh <- &streamResult{}
+
+	if v := testutil.ToFloat64(c); v != 2 {
+		t.Fatalf("expected 2 queued results, got %v", v)
+	}
+}
@@ -4,15 +4,21 @@ package atlas
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/rand"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/DNS-OARC/ripeatlas"
 	"github.com/DNS-OARC/ripeatlas/measurement"
 	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -21,63 +27,109 @@ const (
 	maxRetryDelay = 60 * time.Second
 )
 
+// streamStrategyWorker maintains a single connection to the Streaming API subscribed to one or more measurements
 type streamStrategyWorker struct {
-	resultCh     chan<- *measurement.Result
-	measurement  config.Measurement
-	retryAttempt int
-	strategy     *streamingStrategy
+	ctx            context.Context
+	cancel         context.CancelFunc
+	done           chan struct{}
+	resultCh       chan<- *streamResult
+	measurements   []config.Measurement
+	retryAttempt   atomic.Int32
+	subscribedMu   sync.Mutex
+	subscribed     map[string]bool
+	strategy       *streamingStrategy
+	disconnectedAt time.Time
+	started        time.Time
 }
 
 // getRetryDelay calculates exponential backoff with jitter
 func (w *streamStrategyWorker) getRetryDelay() time.Duration {
 	// Exponential: 1s, 2s, 4s, 8s, 16s, 32s, 60s (capped)
-	delay := minRetryDelay * time.Duration(1<<uint(w.retryAttempt))
-	if delay > maxRetryDelay {
-		delay = maxRetryDelay
+	attempt := w.retryAttempt.Load()
+	delay := maxRetryDelay
+	if attempt < 16 {
+		// larger shifts overflow
+		delay = min(minRetryDelay<<uint(attempt), maxRetryDelay)
 	}
 
 	// Add jitter (±25%) to prevent thundering herd
 	jitter := time.Duration(rand.Int63n(int64(delay / 2)))
 	finalDelay := delay + jitter - (delay / 4)
 
-	log.Debugf("Reconnection attempt %d for measurement #%s, waiting %v",
-		w.retryAttempt+1, w.measurement.ID, finalDelay)
+	log.Debugf("Reconnection attempt %d for %s, waiting %v",
+		attempt+1, w, finalDelay)
 
 	return finalDelay
 }
 
+func (w *streamStrategyWorker) start() {
+	go func() {
+		defer close(w.done)
+
+		if err := w.run(w.ctx); err != nil {
+			log.Errorf("Worker error for %s: %v", w, err)
+			w.setError(err)
+		}
+	}()
+}
+
+// stop closes the connection and waits for the worker to finish
+func (w *streamStrategyWorker) stop() {
+	w.cancel()
+	<-w.done
+}
+
 func (w *streamStrategyWorker) run(ctx context.Context) error {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Errorf("Worker panic for measurement %s: %v", w.measurement.ID, r)
+			log.Errorf("Worker panic for %s: %v", w, r)
+			w.setError(fmt.Errorf("worker panic: %v", r))
 			// Worker will restart via the parent's retry loop
 		}
 	}()
 
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if w.strategy.config().Streaming.Backfill {
+		// results missed until the first connection are fetched once connected
+		w.disconnectedAt = time.Now()
+
+		// Seed measurements with the latest results, otherwise metrics stay empty until each probe reports again
+		w.backfill(ctx, time.Time{})
+	}
+
+	connected := false
 	for {
-		ch, err := w.subscribe()
+		conn, err := w.subscribe()
 		if err != nil {
 			log.Error(err)
-			w.retryAttempt++
+			w.setError(err)
+			w.countPerMeasurement(StreamSubscribeFailuresCounter)
+			w.retryAttempt.Add(1)
 		} else {
-			log.Infof("Subscribed to results of measurement #%s", w.measurement.ID)
-			w.retryAttempt = 0 // Reset on successful connection
-
-			// Increment connected workers count
-			atomic.AddInt32(&w.strategy.connectedWorkers, 1)
+			log.Infof("Connected to stream for %s", w)
+			w.retryAttempt.Store(0) // Reset on successful connection
 
-			// Update connection metric to connected
-			StreamConnectedGauge.WithLabelValues(w.measurement.ID).Set(1)
+			if connected {
+				w.countPerMeasurement(StreamReconnectsCounter)
+			}
+			connected = true
 
-			w.listenForResults(ctx, ch)
+			// Fetch results missed while disconnected
+			if w.strategy.config().Streaming.Backfill && !w.disconnectedAt.IsZero() {
+				go w.backfill(ctx, w.disconnectedAt)
+			}
 
-			// Decrement connected workers count on disconnect
-			atomic.AddInt32(&w.strategy.connectedWorkers, -1)
+			w.listenForResults(ctx, conn.Results())
+			conn.Close()
+			w.disconnectedAt = time.Now()
 
-			// Update connection metric to disconnected
-			StreamConnectedGauge.WithLabelValues(w.measurement.ID).Set(0)
+			// subscriptions have to be confirmed again on the next connection
+			w.resetSubscriptions()
 
-			w.retryAttempt++ // Increment for next reconnection attempt
+			w.retryAttempt.Add(1) // Increment for next reconnection attempt
 		}
 
 		select {
@@ -89,30 +141,193 @@ func (w *streamStrategyWorker) run(ctx context.Context) error {
 	}
 }
 
-func (w *streamStrategyWorker) subscribe() (<-chan *measurement.Result, error) {
-	stream := ripeatlas.NewStream()
+func (w *streamStrategyWorker) String() string {
+	if len(w.measurements) == 1 {
+		return "measurement #" + w.measurements[0].ID
+	}
 
-	msm, err := strconv.Atoi(w.measurement.ID)
-	if err != nil {
-		return nil, err
+	return strconv.Itoa(len(w.measurements)) + " measurements"
+}
+
+// setSubscribed sets if the subscription of a measurement is active on the current connection
+func (w *streamStrategyWorker) setSubscribed(id string, v bool) {
+	w.subscribedMu.Lock()
+	defer w.subscribedMu.Unlock()
+
+	if w.subscribed == nil {
+		w.subscribed = make(map[string]bool)
+	}
+
+	if w.subscribed[id] == v {
+		return
 	}
 
-	ch, err := stream.MeasurementResults(ripeatlas.Params{
-		"msm": msm,
+	w.subscribed[id] = v
+	if v {
+		log.Infof("Subscribed to results of measurement #%s", id)
+		StreamConnectedGauge.WithLabelValues(id).Set(1)
+	} else {
+		StreamConnectedGauge.WithLabelValues(id).Set(0)
+	}
+}
+
+// isSubscribed returns true if the subscription of the measurement was confirmed on the current connection
+func (w *streamStrategyWorker) isSubscribed(id string) bool {
+	w.subscribedMu.Lock()
+	defer w.subscribedMu.Unlock()
+
+	return w.subscribed[id]
+}
+
+// subscribedCount returns the number of measurements subscribed on the current connection
+func (w *streamStrategyWorker) subscribedCount() int {
+	w.subscribedMu.Lock()
+	defer w.subscribedMu.Unlock()
+
+	n := 0
+	for _, v := range w.subscribed {
+		if v {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (w *streamStrategyWorker) hasMeasurement(id string) bool {
+	return slices.ContainsFunc(w.measurements, func(m config.Measurement) bool {
+		return m.ID == id
 	})
+}
+
+func (w *streamStrategyWorker) resetSubscriptions() {
+	for _, m := range w.measurements {
+		w.setSubscribed(m.ID, false)
+	}
+}
+
+// streamEvents returns the handlers of subscription events of the connection
+func (w *streamStrategyWorker) streamEvents() streamEvents {
+	return streamEvents{
+		subscribed: func(msm int) {
+			w.setSubscribed(strconv.Itoa(msm), true)
+		},
+		failed: func(msm int, err error) {
+			if msm == 0 {
+				log.Errorf("Stream error for %s: %v", w, err)
+				w.setError(err)
+				return
+			}
+
+			id := strconv.Itoa(msm)
+			log.Errorf("Stream error for measurement #%s: %v", id, err)
+			w.setSubscribed(id, false)
+			w.strategy.setError(id, err)
+		},
+	}
+}
+
+// setError records the error for all measurements of the worker
+func (w *streamStrategyWorker) setError(err error) {
+	for _, m := range w.measurements {
+		w.strategy.setError(m.ID, err)
+	}
+}
+
+func (w *streamStrategyWorker) countPerMeasurement(c *prometheus.CounterVec) {
+	for _, m := range w.measurements {
+		c.WithLabelValues(m.ID).Inc()
+	}
+}
+
+// backfill retrieves results of all measurements of the worker from the REST API
+func (w *streamStrategyWorker) backfill(ctx context.Context, since time.Time) {
+	if client == nil {
+		log.Warnf("API client not initialized, skipping backfill for %s", w)
+		return
+	}
+
+	for _, m := range w.measurements {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// measurements already held were subscribed before (e.g. on another connection)
+		if since.IsZero() && w.strategy.hasMeasurement(m.ID) {
+			continue
+		}
+
+		w.backfillMeasurement(ctx, m, since)
+	}
+}
+
+// backfillMeasurement retrieves results from the REST API and passes them to the result processing.
+// Without since the latest result of each probe is retrieved, else all results since then.
+func (w *streamStrategyWorker) backfillMeasurement(ctx context.Context, m config.Measurement, since time.Time) {
+	// the key may have changed since the worker was started, connections are kept on changes of keys
+	c := client.WithKey(w.strategy.registry.APIKeyFor(w.strategy.config(), m.ID)).WithContext(ctx)
+
+	var ch <-chan *measurement.Result
+	var err error
+	if since.IsZero() {
+		ch, err = c.MeasurementLatest(ripeatlas.Params{"pk": m.ID})
+	} else {
+		ch, err = c.MeasurementResults(ripeatlas.Params{
+			"pk":    m.ID,
+			"start": since.Unix(),
+			"stop":  time.Now().Unix(),
+		})
+	}
 	if err != nil {
-		return nil, err
+		log.Errorf("could not backfill results for measurement #%s: %v", m.ID, err)
+		w.strategy.setError(m.ID, fmt.Errorf("could not backfill results: %w", err))
+		return
 	}
 
-	return ch, nil
+	n := 0
+	for r := range ch {
+		if r.ParseError != nil {
+			log.Errorf("failed parsing backfilled result for measurement #%s: %v", m.ID, r.ParseError)
+			exporter.ResultsDroppedCounter.WithLabelValues(m.ID, "", "parse_error").Inc()
+			continue
+		}
+
+		// keep draining the channel on shutdown so the producer can finish
+		if ctx.Err() != nil {
+			continue
+		}
+
+		select {
+		case w.resultCh <- &streamResult{Result: r, backfill: true}:
+			n++
+		case <-ctx.Done():
+		}
+	}
+
+	log.Infof("Backfilled %d results for measurement #%s", n, m.ID)
 }
 
-func (w *streamStrategyWorker) listenForResults(ctx context.Context, ch <-chan *measurement.Result) {
+func (w *streamStrategyWorker) subscribe() (*streamConn, error) {
+	msms := make([]int, 0, len(w.measurements))
+	for _, m := range w.measurements {
+		msm, err := strconv.Atoi(m.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		msms = append(msms, msm)
+	}
+
+	return dialStream(w.strategy.config(), msms, w.streamEvents())
+}
+
+func (w *streamStrategyWorker) listenForResults(ctx context.Context, ch <-chan *streamResult) {
 	for {
 		select {
 		case m, ok := <-ch:
 			if !ok {
-				log.Warnf("Stream closed for measurement #%s", w.measurement.ID)
+				log.Warnf("Stream closed for %s", w)
+				w.setError(errors.New("stream closed"))
 				return
 			}
 			if m == nil {
@@ -125,10 +340,20 @@ func (w *streamStrategyWorker) listenForResults(ctx context.Context, ch <-chan *
 
 			if m.ParseError != nil && strings.HasPrefix(m.ParseError.Error(), "c.On(disconnect)") {
 				log.Error(m.ParseError)
+				w.setError(m.ParseError)
 				return
 			}
 
-			w.resultCh <- m
+			// results imply an active subscription, even if its confirmation was missed
+			if id := strconv.Itoa(m.MsmId()); m.ParseError == nil && w.hasMeasurement(id) {
+				w.setSubscribed(id, true)
+			}
+
+			select {
+			case w.resultCh <- m:
+			case <-ctx.Done():
+				return
+			}
 		case <-ctx.Done():
 			return
 		}
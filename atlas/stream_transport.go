@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package atlas
+
+import (
+	"io"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/api"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/gorilla/websocket"
+	"github.com/graarh/golang-socketio/transport"
+)
+
+// streamTransport is a socket.io websocket transport honoring the proxy and CA settings for the Atlas API
+// (the default transport of golang-socketio neither supports proxies nor custom CAs)
+type streamTransport struct {
+	*transport.WebsocketTransport
+	dialer *websocket.Dialer
+}
+
+type streamTransportConn struct {
+	socket    *websocket.Conn
+	transport *streamTransport
+}
+
+func newStreamTransport(cfg *config.Config) (*streamTransport, error) {
+	t, err := api.NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamTransport{
+		WebsocketTransport: transport.GetDefaultWebsocketTransport(),
+		dialer: &websocket.Dialer{
+			Proxy:            t.Proxy,
+			TLSClientConfig:  t.TLSClientConfig,
+			HandshakeTimeout: 45 * time.Second,
+		},
+	}, nil
+}
+
+// Connect implements transport.Transport
+func (t *streamTransport) Connect(url string) (transport.Connection, error) {
+	socket, resp, err := t.dialer.Dial(url, t.RequestHeader)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamTransportConn{socket: socket, transport: t}, nil
+}
+
+// GetMessage implements transport.Connection
+func (c *streamTransportConn) GetMessage() (string, error) {
+	_ = c.socket.SetReadDeadline(time.Now().Add(c.transport.ReceiveTimeout))
+
+	msgType, reader, err := c.socket.NextReader()
+	if err != nil {
+		return "", err
+	}
+
+	if msgType != websocket.TextMessage {
+		return "", transport.ErrorBinaryMessage
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", transport.ErrorBadBuffer
+	}
+
+	if len(data) == 0 {
+		return "", transport.ErrorPacketWrong
+	}
+
+	return string(data), nil
+}
+
+// WriteMessage implements transport.Connection
+func (c *streamTransportConn) WriteMessage(message string) error {
+	_ = c.socket.SetWriteDeadline(time.Now().Add(c.transport.SendTimeout))
+
+	w, err := c.socket.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write([]byte(message)); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// Close implements transport.Connection
+func (c *streamTransportConn) Close() {
+	_ = c.socket.Close()
+}
+
+// PingParams implements transport.Connection
+func (c *streamTransportConn) PingParams() (time.Duration, time.Duration) {
+	return c.transport.PingInterval, c.transport.PingTimeout
+}
@@ -3,30 +3,276 @@
 package main
 
 import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+
 	"github.com/czerwonk/atlas_exporter/exporter"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
+type collectorOpt func(c *collector)
+
+// withSeriesBudget limits the number of series exported per measurement and in total (0 = unlimited).
+// Series of excess probes are dropped, series of priority probes are kept first.
+func withSeriesBudget(perMeasurement, total uint, priorityProbes []int) collectorOpt {
+	return func(c *collector) {
+		if perMeasurement == 0 && total == 0 {
+			return
+		}
+
+		priority := make(map[string]bool, len(priorityProbes))
+		for _, id := range priorityProbes {
+			priority[strconv.Itoa(id)] = true
+		}
+
+		c.budget = &seriesBudget{
+			perMeasurement: int(perMeasurement),
+			total:          int(total),
+			priority:       priority,
+		}
+	}
+}
+
 type collector struct {
 	measurements []*exporter.Measurement
+	budget       *seriesBudget
 }
 
-func newCollector(measurements []*exporter.Measurement) *collector {
-	return &collector{
+func newCollector(measurements []*exporter.Measurement, opts ...collectorOpt) *collector {
+	c := &collector{
 		measurements: measurements,
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
 // Collect implements Prometheus Collector interface
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
-	for _, m := range c.measurements {
-		m.Collect(ch)
+	if c.budget == nil {
+		for _, m := range c.measurements {
+			m.Collect(ch)
+		}
+		return
 	}
+
+	c.budget.collect(c.measurements, ch)
 }
 
-// Describe implements Prometheus Collector interface
+// Describe implements Prometheus Collector interface. If a measurement is configured with custom labels no
+// descriptions are sent (unchecked collector), since its metrics have other label names than the metrics
+// of the same name of other measurements. Label policies apply to all measurements of a type, so they do not
+// lead to different label names.
 func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.measurements {
+		if m.HasLabels() {
+			return
+		}
+	}
+
 	for _, m := range c.measurements {
 		m.Describe(ch)
 	}
 }
+
+// seriesBudget limits the number of series exported
+type seriesBudget struct {
+	perMeasurement int
+	total          int
+	priority       map[string]bool
+}
+
+// collect sends the metrics of the measurements fitting into the budgets and counts the series dropped.
+// Metrics are only grouped by probe if the series of a measurement (or of all measurements) exceed a budget.
+func (b *seriesBudget) collect(measurements []*exporter.Measurement, ch chan<- prometheus.Metric) {
+	kept := make([]*seriesGroup, 0, len(measurements))
+	total := 0
+	for _, m := range measurements {
+		metrics := collectMetrics(m)
+		n := countSeries(metrics)
+
+		if b.perMeasurement == 0 || n <= b.perMeasurement {
+			kept = append(kept, &seriesGroup{metrics: metrics, series: n})
+			total += n
+			continue
+		}
+
+		for _, g := range b.limit(groupSeries(metrics), b.perMeasurement, "measurement") {
+			kept = append(kept, g)
+			total += g.series
+		}
+	}
+
+	if b.total > 0 && total > b.total {
+		all := make([]*seriesGroup, 0, len(kept))
+		for _, g := range kept {
+			if g.grouped {
+				all = append(all, g)
+			} else {
+				all = append(all, groupSeries(g.metrics)...)
+			}
+		}
+
+		kept = b.limit(all, b.total, "total")
+	}
+
+	for _, g := range kept {
+		for _, m := range g.metrics {
+			ch <- m
+		}
+	}
+}
+
+// seriesGroup are the metrics of a measurement for a single probe. Metrics without probe label (e.g. histograms)
+// are grouped with an empty probe. Metrics of a measurement not exceeding its budget are not grouped.
+type seriesGroup struct {
+	measurement string
+	probe       string
+	hash        uint32
+	metrics     []prometheus.Metric
+	series      int
+	grouped     bool
+}
+
+// collectMetrics returns the metrics of c
+func collectMetrics(c prometheus.Collector) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	metrics := make([]prometheus.Metric, 0)
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+
+	return metrics
+}
+
+// countSeries returns the number of series exposed for the metrics. Only histograms are written to
+// count their buckets, all other metrics of measurements expose a single series.
+func countSeries(metrics []prometheus.Metric) int {
+	n := 0
+	for _, m := range metrics {
+		if _, ok := m.(prometheus.Histogram); !ok {
+			n++
+			continue
+		}
+
+		d := &dto.Metric{}
+		if err := m.Write(d); err != nil {
+			n++
+			continue
+		}
+		n += seriesCount(d)
+	}
+
+	return n
+}
+
+// groupSeries groups the metrics by measurement and probe
+func groupSeries(metrics []prometheus.Metric) []*seriesGroup {
+	groups := make([]*seriesGroup, 0)
+	index := make(map[[2]string]*seriesGroup)
+	for _, m := range metrics {
+		d := &dto.Metric{}
+		if err := m.Write(d); err != nil {
+			// the registry reports the error on collection
+			d = &dto.Metric{}
+		}
+
+		var key [2]string
+		for _, l := range d.GetLabel() {
+			switch l.GetName() {
+			case "measurement":
+				key[0] = l.GetValue()
+			case "probe":
+				key[1] = l.GetValue()
+			}
+		}
+
+		g, found := index[key]
+		if !found {
+			g = &seriesGroup{measurement: key[0], probe: key[1], hash: probeHash(key[1]), grouped: true}
+			index[key] = g
+			groups = append(groups, g)
+		}
+
+		g.metrics = append(g.metrics, m)
+		g.series += seriesCount(d)
+	}
+
+	return groups
+}
+
+// seriesCount returns the number of series exposed for a metric
+func seriesCount(d *dto.Metric) int {
+	switch {
+	case d.Histogram != nil:
+		// buckets including +Inf, sum and count
+		return len(d.Histogram.GetBucket()) + 3
+	case d.Summary != nil:
+		return len(d.Summary.GetQuantile()) + 2
+	}
+
+	return 1
+}
+
+func probeHash(probe string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(probe))
+	return h.Sum32()
+}
+
+// limit returns the groups fitting into maxSeries (0 = unlimited) and counts the series of all other groups as dropped.
+// Groups without probe are kept first, followed by the groups of priority probes and the other groups ordered by
+// the hash of the probe ID, so the same probes are kept on every scrape and over all measurements.
+func (b *seriesBudget) limit(groups []*seriesGroup, maxSeries int, budget string) []*seriesGroup {
+	if maxSeries == 0 {
+		return groups
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return b.less(groups[i], groups[j])
+	})
+
+	n := 0
+	for i, g := range groups {
+		if n+g.series > maxSeries {
+			for _, d := range groups[i:] {
+				exporter.SeriesDroppedCounter.WithLabelValues(d.measurement, budget).Add(float64(d.series))
+			}
+			return groups[:i]
+		}
+
+		n += g.series
+	}
+
+	return groups
+}
+
+func (b *seriesBudget) less(x, y *seriesGroup) bool {
+	if (x.probe == "") != (y.probe == "") {
+		return x.probe == ""
+	}
+
+	if b.priority[x.probe] != b.priority[y.probe] {
+		return b.priority[x.probe]
+	}
+
+	if x.hash != y.hash {
+		return x.hash < y.hash
+	}
+
+	if x.probe != y.probe {
+		return x.probe < y.probe
+	}
+
+	return x.measurement < y.measurement
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/exporter"
+	"github.com/czerwonk/atlas_exporter/ping"
+	"github.com/czerwonk/atlas_exporter/probe"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// pingMeasurement returns a ping measurement with failed results of probes 1-10 (6 series per probe, 7 series histogram)
+func pingMeasurement(t *testing.T, id int) *exporter.Measurement {
+	t.Helper()
+
+	m := ping.NewMeasurement(fmt.Sprint(id), "4", config.MeasurementSettings{})
+	for p := 1; p <= 10; p++ {
+		res := &measurement.Result{}
+		js := fmt.Sprintf(`{"msm_id":%d,"prb_id":%d,"af":4,"type":"ping","timestamp":%d}`, id, p, time.Now().Unix())
+		if err := json.Unmarshal([]byte(js), res); err != nil {
+			t.Fatalf("could not parse result: %v", err)
+		}
+		m.Add(res, &probe.Probe{ID: p})
+	}
+
+	return m
+}
+
+// exportedProbes returns the probes exported per measurement
+func exportedProbes(t *testing.T, c prometheus.Collector) map[string][]string {
+	t.Helper()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("could not gather metrics: %v", err)
+	}
+
+	probes := make(map[string][]string)
+	for _, mf := range mfs {
+		if mf.GetName() != "atlas_ping_sent" {
+			continue
+		}
+
+		for _, m := range mf.GetMetric() {
+			var msm, prb string
+			for _, l := range m.GetLabel() {
+				switch l.GetName() {
+				case "measurement":
+					msm = l.GetValue()
+				case "probe":
+					prb = l.GetValue()
+				}
+			}
+			probes[msm] = append(probes[msm], prb)
+		}
+	}
+
+	for _, p := range probes {
+		slices.Sort(p)
+	}
+
+	return probes
+}
+
+func TestCollectorSeriesBudgetPerMeasurement(t *testing.T) {
+	m := pingMeasurement(t, 1001)
+	c := newCollector([]*exporter.Measurement{m}, withSeriesBudget(25, 0, []int{10}))
+
+	if n := testutil.CollectAndCount(c); n != 19 {
+		t.Fatalf("expected histogram and metrics of 3 probes (19 metrics), got %d", n)
+	}
+
+	probes := exportedProbes(t, c)["1001"]
+	if len(probes) != 3 || !slices.Contains(probes, "10") {
+		t.Fatalf("expected 3 probes including priority probe 10, got %v", probes)
+	}
+
+	for i := 0; i < 3; i++ {
+		if p := exportedProbes(t, c)["1001"]; !slices.Equal(p, probes) {
+			t.Fatalf("expected the same probes on every scrape, got %v and %v", probes, p)
+		}
+	}
+
+	if v := seriesDropped(t, c, "1001", "measurement"); v != 7*6 {
+		t.Fatalf("expected 42 dropped series of 7 probes on every scrape, got %v", v)
+	}
+}
+
+func TestCollectorSeriesBudgetTotal(t *testing.T) {
+	ms := []*exporter.Measurement{pingMeasurement(t, 2001), pingMeasurement(t, 2002)}
+	c := newCollector(ms, withSeriesBudget(0, 38, nil))
+
+	probes := exportedProbes(t, c)
+	if len(probes["2001"]) != 2 || !slices.Equal(probes["2001"], probes["2002"]) {
+		t.Fatalf("expected the same 2 probes for both measurements, got %v", probes)
+	}
+
+	if v := seriesDropped(t, c, "2001", "total"); v != 48 {
+		t.Fatalf("expected 48 dropped series, got %v", v)
+	}
+}
+
+func TestCollectorSeriesBudgetNotExceeded(t *testing.T) {
+	ms := []*exporter.Measurement{pingMeasurement(t, 3001), pingMeasurement(t, 3002)}
+	c := newCollector(ms, withSeriesBudget(67, 134, nil))
+
+	if n := len(exportedProbes(t, c)["3001"]); n != 10 {
+		t.Fatalf("expected all probes to be exported, got %d", n)
+	}
+
+	for _, budget := range []string{"measurement", "total"} {
+		if v := seriesDropped(t, c, "3001", budget); v != 0 {
+			t.Fatalf("expected no dropped series, got %v", v)
+		}
+	}
+}
+
+// seriesDropped returns the number of series counted as dropped on a scrape
+func seriesDropped(t *testing.T, c prometheus.Collector, id, budget string) float64 {
+	t.Helper()
+
+	before := testutil.ToFloat64(exporter.SeriesDroppedCounter.WithLabelValues(id, budget))
+	testutil.CollectAndCount(c)
+
+	return testutil.ToFloat64(exporter.SeriesDroppedCounter.WithLabelValues(id, budget)) - before
+}
+
+func TestCollectorDescribe(t *testing.T) {
+	settings := config.MeasurementSettings{
+		LabelPolicies: map[string]config.LabelPolicy{"ping": {Add: []string{"is_anchor", "tag:system-ipv6-works"}}},
+	}
+	newMeasurement := func(id int, labels map[string]string) *exporter.Measurement {
+		s := settings
+		s.Labels = labels
+		m := ping.NewMeasurement(fmt.Sprint(id), "4", s)
+
+		res := &measurement.Result{}
+		js := fmt.Sprintf(`{"msm_id":%d,"prb_id":1,"af":4,"type":"ping","timestamp":%d,"sent":3,"rcvd":1,"avg":10,"min":10,"max":10,`+
+			`"result":[{"rtt":10},{"x":"*"},{"error":"sendto failed: Network is unreachable"}]}`, id, time.Now().Unix())
+		if err := json.Unmarshal([]byte(js), res); err != nil {
+			t.Fatalf("could not parse result: %v", err)
+		}
+		m.Add(res, &probe.Probe{ID: 1})
+
+		return m
+	}
+
+	describe := func(c prometheus.Collector) int {
+		ch := make(chan *prometheus.Desc)
+		go func() {
+			c.Describe(ch)
+			close(ch)
+		}()
+
+		n := 0
+		for range ch {
+			n++
+		}
+		return n
+	}
+
+	// metrics are checked against the descriptions
+	c := newCollector([]*exporter.Measurement{newMeasurement(4001, nil), newMeasurement(4002, nil)})
+	if describe(c) == 0 {
+		t.Fatalf("expected descriptions of measurements without custom labels")
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	if _, err := reg.Gather(); err != nil {
+		t.Fatalf("expected consistent metrics, got %v", err)
+	}
+
+	// custom labels of a measurement change the label names of its metrics
+	c = newCollector([]*exporter.Measurement{newMeasurement(4001, nil), newMeasurement(4002, map[string]string{"team": "netops"})})
+	if n := describe(c); n != 0 {
+		t.Fatalf("expected unchecked collector with custom labels, got %d descriptions", n)
+	}
+	reg = prometheus.NewRegistry()
+	reg.MustRegister(c)
+	if _, err := reg.Gather(); err != nil {
+		t.Fatalf("expected metrics with custom labels to be gathered, got %v", err)
+	}
+}
@@ -5,25 +5,69 @@ package config
 // Defaults returns the default configuration as a flat map of canonical keys
 func Defaults() map[string]any {
 	return map[string]any{
-		"web.listen_address":      ":9400",
-		"web.telemetry_path":      "/metrics",
-		"cache.ttl":               "3600s",
-		"cache.cleanup":           "300s",
-		"timeout":                 "60s",
-		"worker.count":            8,
-		"streaming.enabled":       true,
-		"streaming.buffer_size":   100,
-		"profiling.enabled":       false,
-		"metrics.go_enabled":      true,
-		"metrics.process_enabled": true,
-		"log.level":               "info",
-		"tls.enabled":             false,
-		"tls.cert_file":           "",
-		"tls.key_file":            "",
-		"health.max_data_age":     "0s",
-		"filter_invalid_results":  true,
-		"max_result_age":          "0s",
-		"dns.nsid_enabled":        true,
+		"web.listen_address":               ":9400",
+		"web.telemetry_path":               "/metrics",
+		"cache.ttl":                        "3600s",
+		"cache.cleanup":                    "300s",
+		"cache.file":                       "",
+		"cache.save_interval":              "5m",
+		"cache.stale_ttl":                  "24h",
+		"cache.negative_ttl":               "5m",
+		"cache.max_size":                   50000,
+		"timeout":                          "60s",
+		"atlas.api_url":                    "https://atlas.ripe.net/api/v2",
+		"atlas.stream_url":                 "wss://atlas-stream.ripe.net:443/stream/socket.io/?EIO=3&transport=websocket",
+		"atlas.proxy_url":                  "",
+		"atlas.ca_file":                    "",
+		"atlas.api_key":                    "",
+		"atlas.api_key_file":               "",
+		"atlas.timeout":                    "30s",
+		"atlas.retries":                    3,
+		"atlas.rate_limit":                 10.0,
+		"atlas.rate_burst":                 20,
+		"worker.count":                     8,
+		"probes.batch_size":                100,
+		"probes.batch_window":              "100ms",
+		"streaming.enabled":                true,
+		"streaming.buffer_size":            100,
+		"streaming.backfill":               true,
+		"streaming.connections":            0,
+		"replay.enabled":                   false,
+		"replay.path":                      "",
+		"replay.speed":                     0.0,
+		"replay.probes_file":               "",
+		"record.enabled":                   false,
+		"record.path":                      "",
+		"record.rotate_interval":           "1h",
+		"record.compress":                  true,
+		"record.max_age":                   "0s",
+		"record.max_size_mb":               0,
+		"profiling.enabled":                false,
+		"metrics.go_enabled":               true,
+		"metrics.process_enabled":          true,
+		"metrics.measurement_info_enabled": true,
+		"metrics.probe_info_enabled":       true,
+		"log.level":                        "info",
+		"tls.enabled":                      false,
+		"tls.cert_file":                    "",
+		"tls.key_file":                     "",
+		"discovery.interval":               "10m",
+		"admin.enabled":                    false,
+		"admin.token":                      "",
+		"admin.token_file":                 "",
+		"reload.watch":                     false,
+		"health.max_data_age":              "0s",
+		"health.min_connected_percent":     0,
+		"health.interval_factor":           0.0,
+		"health.min_fresh_percent":         100,
+		"health.api_success_max_age":       "0s",
+		"results.retention":                "0s",
+		"results.max_probes":               0,
+		"series.max_per_measurement":       0,
+		"series.max_total":                 0,
+		"filter_invalid_results":           true,
+		"max_result_age":                   "0s",
+		"dns.nsid_enabled":                 true,
 		// hist buckets default to empty; measurements default to empty
 	}
 }
@@ -5,8 +5,11 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,6 +26,19 @@ import (
 
 const (
 	envPrefix = "ATLAS_"
+
+	// maxProbeBatchSize is the max. page size of the probes API
+	maxProbeBatchSize = 500
+)
+
+var (
+	labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// reservedLabels are the labels of the metrics exported for measurements, which can not be overridden
+	reservedLabels = []string{"measurement", "probe", "dst_addr", "dst_name", "ip_version", "nsid", "uri", "method",
+		"protocol", "cert_fingerprint", "error"}
+
+	measurementTypes = []string{"ping", "traceroute", "dns", "http", "ntp", "sslcert"}
 )
 
 // RegisterFlags defines all supported flags with default values.
@@ -34,18 +50,62 @@ func RegisterFlags(fs *pflag.FlagSet) {
 	fs.String("web.telemetry_path", d["web.telemetry_path"].(string), "Path under which to expose metrics.")
 	fs.String("cache.ttl", d["cache.ttl"].(string), "Cache TTL (duration e.g. 3600s)")
 	fs.String("cache.cleanup", d["cache.cleanup"].(string), "Cache cleanup interval (duration)")
+	fs.String("cache.file", d["cache.file"].(string), "File to persist the probe cache in across restarts (disabled if empty)")
+	fs.String("cache.save_interval", d["cache.save_interval"].(string), "Interval to write the probe cache file (duration)")
+	fs.String("cache.stale_ttl", d["cache.stale_ttl"].(string), "Time expired probes are served while they are refreshed (duration)")
+	fs.String("cache.negative_ttl", d["cache.negative_ttl"].(string), "Time failed lookups of probes and measurement definitions are cached (duration)")
+	fs.Uint("cache.max_size", uint(d["cache.max_size"].(int)), "Max. number of cached probes, least recently used are evicted (0 = unlimited)")
 	fs.String("timeout", d["timeout"].(string), "Timeout for metrics requests (duration)")
+	fs.String("atlas.api_url", d["atlas.api_url"].(string), "Base URL of the RIPE Atlas REST API")
+	fs.String("atlas.stream_url", d["atlas.stream_url"].(string), "URL of the RIPE Atlas Streaming API (socket.io websocket)")
+	fs.String("atlas.proxy_url", d["atlas.proxy_url"].(string), "HTTP proxy for Atlas API and stream connections (default: proxy environment variables)")
+	fs.String("atlas.ca_file", d["atlas.ca_file"].(string), "Additional CA bundle (PEM) to verify Atlas API and stream connections")
+	fs.String("atlas.api_key", d["atlas.api_key"].(string), "RIPE Atlas API key for non-public measurements (prefer api_key_file or env)")
+	fs.String("atlas.api_key_file", d["atlas.api_key_file"].(string), "File containing the RIPE Atlas API key")
+	fs.String("atlas.timeout", d["atlas.timeout"].(string), "Timeout of a single Atlas API request (duration)")
+	fs.Uint("atlas.retries", uint(d["atlas.retries"].(int)), "Number of retries of Atlas API requests failing with 429, 5xx or network errors")
+	fs.Float64("atlas.rate_limit", d["atlas.rate_limit"].(float64), "Max. Atlas API requests per second shared by all workers (0 = unlimited)")
+	fs.Uint("atlas.rate_burst", uint(d["atlas.rate_burst"].(int)), "Max. burst of Atlas API requests exceeding the rate limit")
 	fs.Uint("worker.count", uint(d["worker.count"].(int)), "Number of goroutines retrieving probe information")
+	fs.Uint("probes.batch_size", uint(d["probes.batch_size"].(int)), "Max. number of probes retrieved by a single probes API request")
+	fs.String("probes.batch_window", d["probes.batch_window"].(string), "Time to collect probe lookups of streamed results for a single request (duration)")
 	fs.Bool("streaming.enabled", d["streaming.enabled"].(bool), "Retrieve data via Atlas Streaming API")
 	fs.Uint("streaming.buffer_size", uint(d["streaming.buffer_size"].(int)), "Buffer size for streaming worker channel")
+	fs.Uint("streaming.connections", uint(d["streaming.connections"].(int)), "Number of connections to the Streaming API measurements are multiplexed over (0 = one per measurement)")
+	fs.Bool("streaming.backfill", d["streaming.backfill"].(bool), "Retrieve latest results via REST API on start and missed results after reconnects")
+	fs.Bool("replay.enabled", d["replay.enabled"].(bool), "Replay recorded results from JSONL files instead of using the Atlas API")
+	fs.String("replay.path", d["replay.path"].(string), "JSONL file or directory to replay results from")
+	fs.Float64("replay.speed", d["replay.speed"].(float64), "Replay speed factor (1=original pace, >1=accelerated, 0=all at once)")
+	fs.String("replay.probes_file", d["replay.probes_file"].(string), "Optional JSONL file with probe metadata used instead of the probes API")
+	fs.Bool("record.enabled", d["record.enabled"].(bool), "Archive every streamed result to JSONL files")
+	fs.String("record.path", d["record.path"].(string), "Directory to archive streamed results in")
+	fs.String("record.rotate_interval", d["record.rotate_interval"].(string), "Interval to rotate archive files (duration)")
+	fs.Bool("record.compress", d["record.compress"].(bool), "Compress archive files using gzip")
+	fs.String("record.max_age", d["record.max_age"].(string), "Remove archive files older than this (duration, 0s=disabled)")
+	fs.Uint("record.max_size_mb", uint(d["record.max_size_mb"].(int)), "Max size of archive files per measurement in MiB, oldest are removed first (0=disabled)")
 	fs.Bool("profiling.enabled", d["profiling.enabled"].(bool), "Enable pprof endpoints")
 	fs.Bool("metrics.go_enabled", d["metrics.go_enabled"].(bool), "Enable Go runtime metrics")
 	fs.Bool("metrics.process_enabled", d["metrics.process_enabled"].(bool), "Enable process metrics")
+	fs.Bool("metrics.measurement_info_enabled", d["metrics.measurement_info_enabled"].(bool), "Export definitions of measurements retrieved from the Atlas API")
+	fs.Bool("metrics.probe_info_enabled", d["metrics.probe_info_enabled"].(bool), "Export attributes of probes results are held for")
 	fs.String("log.level", d["log.level"].(string), "Log level: debug|info|warn|error|fatal")
 	fs.Bool("tls.enabled", d["tls.enabled"].(bool), "Enable TLS for HTTP server")
 	fs.String("tls.cert_file", d["tls.cert_file"].(string), "Path to TLS certificate file")
 	fs.String("tls.key_file", d["tls.key_file"].(string), "Path to TLS key file")
+	fs.String("discovery.interval", d["discovery.interval"].(string), "Interval to resolve measurement discovery rules (duration)")
+	fs.Bool("admin.enabled", d["admin.enabled"].(bool), "Enable admin API to manage measurements at runtime (/api/v1/measurements)")
+	fs.String("admin.token", d["admin.token"].(string), "Bearer token required by the admin API (prefer token_file or env)")
+	fs.String("admin.token_file", d["admin.token_file"].(string), "File containing the bearer token required by the admin API")
+	fs.Bool("reload.watch", d["reload.watch"].(bool), "Reload configuration when the config file changes (SIGHUP always triggers a reload)")
 	fs.String("health.max_data_age", d["health.max_data_age"].(string), "Max data age for readiness check (duration, 0s=disabled)")
+	fs.Uint("health.min_connected_percent", uint(d["health.min_connected_percent"].(int)), "Percentage of measurements required to be subscribed on a connected stream for readiness (0 = at least one)")
+	fs.Float64("health.interval_factor", d["health.interval_factor"].(float64), "Measurement is stale if no result was received for this factor times its interval (0 = disabled)")
+	fs.Uint("health.min_fresh_percent", uint(d["health.min_fresh_percent"].(int)), "Percentage of measurements required not to be stale for readiness (requires health.interval_factor)")
+	fs.String("health.api_success_max_age", d["health.api_success_max_age"].(string), "Request mode: not ready if the last API request failed and none succeeded within this duration (0s = disabled)")
+	fs.String("results.retention", d["results.retention"].(string), "Remove results older than this in streaming mode (duration, 0s=keep)")
+	fs.Uint("results.max_probes", uint(d["results.max_probes"].(int)), "Max. number of probes results are held for per measurement, oldest are removed (0 = unlimited)")
+	fs.Uint("series.max_per_measurement", uint(d["series.max_per_measurement"].(int)), "Max. number of result series exported per measurement, series of excess probes are dropped (0 = unlimited)")
+	fs.Uint("series.max_total", uint(d["series.max_total"].(int)), "Max. number of result series exported over all measurements (0 = unlimited)")
 	fs.Bool("filter_invalid_results", d["filter_invalid_results"].(bool), "Filter invalid results by IP version capability")
 	fs.String("max_result_age", d["max_result_age"].(string), "Skip results older than this (duration, 0s=disabled)")
 	fs.Bool("dns.nsid_enabled", d["dns.nsid_enabled"].(bool), "Enable DNS NSID label (may increase cardinality)")
@@ -63,19 +123,8 @@ func Load(fs *pflag.FlagSet) (*Config, error) {
 		return nil, fmt.Errorf("load defaults: %w", err)
 	}
 
-	// Resolve config file path from flag or env
-	filePath := ""
-	if f := fs.Lookup("config.file"); f != nil {
-		filePath = f.Value.String()
-	}
-	if filePath == "" {
-		filePath = os.Getenv(envPrefix + "CONFIG_FILE")
-	}
-	if filePath != "" {
-		// Expand and load if exists
-		if abs, err := filepath.Abs(filePath); err == nil {
-			filePath = abs
-		}
+	// 2. yaml file (path from flag or env)
+	if filePath := FilePath(fs); filePath != "" {
 		if err := k.Load(file.Provider(filePath), yaml.Parser()); err != nil {
 			return nil, fmt.Errorf("load yaml file %s: %w", filePath, err)
 		}
@@ -112,12 +161,55 @@ func Load(fs *pflag.FlagSet) (*Config, error) {
 		return nil, fmt.Errorf("unmarshal: %w", err)
 	}
 
+	if err := loadSecretFile(&cfg.Atlas.APIKey, cfg.Atlas.APIKeyFile, "api key"); err != nil {
+		return nil, err
+	}
+	if err := loadSecretFile(&cfg.Admin.Token, cfg.Admin.TokenFile, "admin token"); err != nil {
+		return nil, err
+	}
+
 	if err := Validate(&cfg); err != nil {
 		return nil, err
 	}
 	return &cfg, nil
 }
 
+// FilePath returns the absolute path of the config file set by flag or env (empty if none)
+func FilePath(fs *pflag.FlagSet) string {
+	filePath := ""
+	if fs != nil {
+		if f := fs.Lookup("config.file"); f != nil {
+			filePath = f.Value.String()
+		}
+	}
+	if filePath == "" {
+		filePath = os.Getenv(envPrefix + "CONFIG_FILE")
+	}
+	if filePath == "" {
+		return ""
+	}
+
+	if abs, err := filepath.Abs(filePath); err == nil {
+		filePath = abs
+	}
+	return filePath
+}
+
+// loadSecretFile reads the secret from a file unless it was set explicitly
+func loadSecretFile(s *Secret, path, name string) error {
+	if path == "" || *s != "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read %s file: %w", name, err)
+	}
+
+	*s = Secret(strings.TrimSpace(string(b)))
+	return nil
+}
+
 // normalizeArrays converts maps with numeric keys created via env into arrays where needed.
 func normalizeArrays(k *koanf.Koanf) {
 	// measurements: expect array of objects
@@ -174,21 +266,180 @@ func Validate(c *Config) error {
 			return errors.New("tls enabled but cert_file or key_file missing")
 		}
 	}
-	// histogram buckets must be non-negative and non-decreasing
+	if err := validateURL("atlas.api_url", c.Atlas.APIURL, "http", "https"); err != nil {
+		return err
+	}
+	if err := validateURL("atlas.stream_url", c.Atlas.StreamURL, "ws", "wss"); err != nil {
+		return err
+	}
+	if c.Atlas.ProxyURL != "" {
+		if err := validateURL("atlas.proxy_url", c.Atlas.ProxyURL, "http", "https", "socks5"); err != nil {
+			return err
+		}
+	}
+	if c.Atlas.Timeout <= 0 {
+		return errors.New("atlas.timeout must be > 0")
+	}
+	if c.Atlas.RateLimit < 0 {
+		return errors.New("atlas.rate_limit must be >= 0")
+	}
+	if c.Atlas.RateLimit > 0 && c.Atlas.RateBurst == 0 {
+		return errors.New("atlas.rate_burst must be > 0")
+	}
+	if c.Admin.Enabled && c.Admin.Token == "" {
+		return errors.New("admin enabled but token missing")
+	}
+	if c.Replay.Enabled && c.Replay.Path == "" {
+		return errors.New("replay enabled but path missing")
+	}
+	if c.Replay.Speed < 0 {
+		return errors.New("replay.speed must be >= 0")
+	}
+	if c.Record.Enabled {
+		if c.Record.Path == "" {
+			return errors.New("record enabled but path missing")
+		}
+		if c.Record.RotateInterval <= 0 {
+			return errors.New("record.rotate_interval must be > 0")
+		}
+	}
+	if c.Cache.File != "" && c.Cache.SaveInterval <= 0 {
+		return errors.New("cache.save_interval must be > 0")
+	}
+	if c.Probes.BatchSize == 0 || c.Probes.BatchSize > maxProbeBatchSize {
+		return fmt.Errorf("probes.batch_size must be between 1 and %d", maxProbeBatchSize)
+	}
+	if c.Probes.BatchWindow < 0 {
+		return errors.New("probes.batch_window must be >= 0")
+	}
+	if len(c.Discovery.Rules) > 0 && c.Discovery.Interval <= 0 {
+		return errors.New("discovery.interval must be > 0")
+	}
+	for i, r := range c.Discovery.Rules {
+		if err := validateDiscoveryRule(r); err != nil {
+			return fmt.Errorf("discovery rule %d: %w", i, err)
+		}
+	}
+	if err := validateHistogramBuckets(c.HistogramBuckets); err != nil {
+		return err
+	}
+	for t, p := range c.LabelPolicies {
+		if err := validateLabelPolicy(t, p); err != nil {
+			return fmt.Errorf("label_policy.%s: %w", t, err)
+		}
+	}
+	for _, m := range c.Measurements {
+		if err := validateMeasurement(m); err != nil {
+			return fmt.Errorf("measurement %s: %w", m.ID, err)
+		}
+	}
+	if c.Health.MinConnectedPercent > 100 {
+		return errors.New("health.min_connected_percent must be <= 100")
+	}
+	if c.Health.MinFreshPercent > 100 {
+		return errors.New("health.min_fresh_percent must be <= 100")
+	}
+	if c.Health.IntervalFactor < 0 {
+		return errors.New("health.interval_factor must be >= 0")
+	}
+	for _, id := range c.Series.PriorityProbes {
+		if id <= 0 {
+			return fmt.Errorf("series.priority_probes: invalid probe ID %d", id)
+		}
+	}
+	// durations are >= 0 implicitly by type; but ensure not negative due to parsing
+	if c.Results.Retention < 0 {
+		return errors.New("results.retention must be >= 0")
+	}
+	if c.Cache.TTL < 0 || c.Cache.Cleanup < 0 || c.Cache.StaleTTL < 0 || c.Cache.NegativeTTL < 0 || c.Timeout < 0 || c.MaxResultAge < 0 || c.Health.MaxDataAge < 0 || c.Health.APISuccessMaxAge < 0 || c.Record.MaxAge < 0 {
+		return errors.New("duration values must be >= 0")
+	}
+	return nil
+}
+
+func validateURL(name, v string, schemes ...string) error {
+	u, err := url.Parse(v)
+	if err != nil {
+		return fmt.Errorf("%s is invalid: %w", name, err)
+	}
+	if !slices.Contains(schemes, u.Scheme) || u.Host == "" {
+		return fmt.Errorf("%s must be an absolute URL with scheme %s", name, strings.Join(schemes, "|"))
+	}
+	return nil
+}
+
+func validateDiscoveryRule(r DiscoveryRule) error {
+	if len(r.Tags) == 0 && r.Type == "" && len(r.Status) == 0 && r.Target == "" && r.Description == "" && !r.Mine {
+		return errors.New("at least one filter is required")
+	}
+	if r.Description != "" {
+		if _, err := regexp.Compile(r.Description); err != nil {
+			return fmt.Errorf("invalid description regex: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateHistogramBuckets checks buckets are non-negative and non-decreasing
+func validateHistogramBuckets(h HistogramBuckets) error {
 	for name, b := range map[string][]float64{
-		"dns.rtt":        c.HistogramBuckets.DNS.Rtt,
-		"http.rtt":       c.HistogramBuckets.HTTP.Rtt,
-		"ping.rtt":       c.HistogramBuckets.Ping.Rtt,
-		"traceroute.rtt": c.HistogramBuckets.Traceroute.Rtt,
+		"dns.rtt":        h.DNS.Rtt,
+		"http.rtt":       h.HTTP.Rtt,
+		"ping.rtt":       h.Ping.Rtt,
+		"traceroute.rtt": h.Traceroute.Rtt,
 	} {
 		if !isNonDecreasingNonNegative(b) {
 			return fmt.Errorf("histogram_buckets.%s must be non-negative and non-decreasing", name)
 		}
 	}
-	// durations are >= 0 implicitly by type; but ensure not negative due to parsing
-	if c.Cache.TTL < 0 || c.Cache.Cleanup < 0 || c.Timeout < 0 || c.MaxResultAge < 0 || c.Health.MaxDataAge < 0 {
+	return nil
+}
+
+func validateMeasurement(m Measurement) error {
+	if err := validateHistogramBuckets(m.HistogramBuckets); err != nil {
+		return err
+	}
+	if m.Timeout < 0 || (m.MaxResultAge != nil && *m.MaxResultAge < 0) {
 		return errors.New("duration values must be >= 0")
 	}
+	for name := range m.Labels {
+		if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if slices.Contains(reservedLabels, name) || slices.Contains(DefaultProbeLabels, name) ||
+			slices.Contains(OptionalProbeLabels, name) || strings.HasPrefix(name, "tag_") {
+			return fmt.Errorf("label %s is set by the exporter", name)
+		}
+	}
+	return nil
+}
+
+func validateLabelPolicy(t string, p LabelPolicy) error {
+	if t != "default" && !slices.Contains(measurementTypes, t) {
+		return fmt.Errorf("unknown measurement type %s", t)
+	}
+	for _, l := range p.Drop {
+		if !slices.Contains(DefaultProbeLabels, l) {
+			return fmt.Errorf("label %s can not be dropped", l)
+		}
+	}
+	names := make(map[string]string)
+	for _, l := range p.Add {
+		if other, found := names[ProbeLabelName(l)]; found && other != l {
+			return fmt.Errorf("labels %s and %s both are exported as label %s", other, l, ProbeLabelName(l))
+		}
+		names[ProbeLabelName(l)] = l
+
+		if tag, found := strings.CutPrefix(l, "tag:"); found {
+			if tag == "" {
+				return errors.New("tag slug missing")
+			}
+			continue
+		}
+		if !slices.Contains(OptionalProbeLabels, l) {
+			return fmt.Errorf("unknown label %s", l)
+		}
+	}
 	return nil
 }
 
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/require"
@@ -105,6 +107,8 @@ func TestBooleanAndNumericParsing(t *testing.T) {
 	t.Setenv("ATLAS_PROFILING__ENABLED", "true")
 	t.Setenv("ATLAS_WORKER__COUNT", "12")
 	t.Setenv("ATLAS_STREAMING__BUFFER_SIZE", "200")
+	t.Setenv("ATLAS_STREAMING__BACKFILL", "false")
+	t.Setenv("ATLAS_STREAMING__CONNECTIONS", "4")
 	require.NoError(t, fs.Parse([]string{}))
 
 	cfg, err := Load(fs)
@@ -115,6 +119,8 @@ func TestBooleanAndNumericParsing(t *testing.T) {
 	require.True(t, cfg.Profiling.Enabled)
 	require.Equal(t, uint(12), cfg.Worker.Count)
 	require.Equal(t, uint(200), cfg.Streaming.BufferSize)
+	require.False(t, cfg.Streaming.Backfill)
+	require.Equal(t, uint(4), cfg.Streaming.Connections)
 }
 
 func TestDefaultsApplied(t *testing.T) {
@@ -131,6 +137,8 @@ func TestDefaultsApplied(t *testing.T) {
 	require.Equal(t, uint(8), cfg.Worker.Count)
 	require.True(t, cfg.Streaming.Enabled)
 	require.Equal(t, uint(100), cfg.Streaming.BufferSize)
+	require.True(t, cfg.Streaming.Backfill)
+	require.Equal(t, uint(0), cfg.Streaming.Connections)
 	require.False(t, cfg.Profiling.Enabled)
 	require.True(t, cfg.Metrics.GoEnabled)
 	require.True(t, cfg.Metrics.ProcessEnabled)
@@ -296,3 +304,252 @@ func TestInvalidDurationFormat(t *testing.T) {
 	_, err := Load(fs)
 	require.Error(t, err)
 }
+
+func TestValidation_Replay(t *testing.T) {
+	// enabled but missing path
+	fs := newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--replay.enabled=true"}))
+	_, err := Load(fs)
+	require.Error(t, err)
+
+	// negative speed
+	fs = newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--replay.enabled=true", "--replay.path=/tmp", "--replay.speed=-1"}))
+	_, err = Load(fs)
+	require.Error(t, err)
+
+	fs = newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--replay.enabled=true", "--replay.path=/tmp", "--replay.speed=10"}))
+	cfg, err := Load(fs)
+	require.NoError(t, err)
+	require.True(t, cfg.Replay.Enabled)
+	require.Equal(t, 10.0, cfg.Replay.Speed)
+}
+
+func TestAtlasEndpoints(t *testing.T) {
+	fs := newFlagSet()
+	require.NoError(t, fs.Parse([]string{}))
+	cfg, err := Load(fs)
+	require.NoError(t, err)
+	require.Equal(t, "https://atlas.ripe.net/api/v2", cfg.Atlas.APIURL)
+	require.Contains(t, cfg.Atlas.StreamURL, "wss://atlas-stream.ripe.net")
+
+	fs = newFlagSet()
+	t.Setenv("ATLAS_ATLAS__API_URL", "http://localhost:8080/api/v2")
+	t.Setenv("ATLAS_ATLAS__PROXY_URL", "http://proxy:3128")
+	require.NoError(t, fs.Parse([]string{"--atlas.stream_url=ws://localhost:8081/stream/socket.io/?EIO=3&transport=websocket"}))
+	cfg, err = Load(fs)
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:8080/api/v2", cfg.Atlas.APIURL)
+	require.Equal(t, "ws://localhost:8081/stream/socket.io/?EIO=3&transport=websocket", cfg.Atlas.StreamURL)
+	require.Equal(t, "http://proxy:3128", cfg.Atlas.ProxyURL)
+
+	// stream URL must be a websocket URL
+	fs = newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--atlas.stream_url=https://atlas-stream.ripe.net"}))
+	_, err = Load(fs)
+	require.Error(t, err)
+}
+
+func TestAPIKey(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(keyPath, []byte("file-key\n"), 0o600))
+	yamlPath := filepath.Join(dir, "cfg.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte("measurements:\n  - id: 123\n  - id: 456\n    api_key: other-key\n"), 0o600))
+
+	fs := newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--config.file=" + yamlPath, "--atlas.api_key_file=" + keyPath}))
+	cfg, err := Load(fs)
+	require.NoError(t, err)
+
+	require.Equal(t, Secret("file-key"), cfg.APIKeyFor("123"))
+	require.Equal(t, Secret("other-key"), cfg.APIKeyFor("456"))
+	require.Equal(t, Secret("file-key"), cfg.APIKeyFor("789"))
+
+	// explicit key takes precedence over key file
+	t.Setenv("ATLAS_ATLAS__API_KEY", "env-key")
+	fs = newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--atlas.api_key_file=" + keyPath}))
+	cfg, err = Load(fs)
+	require.NoError(t, err)
+	require.Equal(t, Secret("env-key"), cfg.Atlas.APIKey)
+
+	// keys are never printed
+	require.NotContains(t, fmt.Sprintf("%v %+v %#v", cfg.Atlas.APIKey, cfg.Atlas, cfg.Atlas), "env-key")
+
+	fs = newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--atlas.api_key_file=/does/not/exist"}))
+	t.Setenv("ATLAS_ATLAS__API_KEY", "")
+	_, err = Load(fs)
+	require.Error(t, err)
+}
+
+func TestDiscoveryRules_YAML(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "cfg.yaml")
+	err := os.WriteFile(yamlPath, []byte(`discovery:
+  interval: 5m
+  rules:
+    - name: anycast
+      tags: [anycast, dns]
+      type: dns
+      status: [ongoing]
+      description: "^resolver"
+    - mine: true
+      api_key: secret
+`), 0o600)
+	require.NoError(t, err)
+
+	fs := newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--config.file=" + yamlPath}))
+
+	cfg, err := Load(fs)
+	require.NoError(t, err)
+	require.Equal(t, int64(300), int64(cfg.Discovery.Interval.Seconds()))
+	require.Len(t, cfg.Discovery.Rules, 2)
+	require.Equal(t, []string{"anycast", "dns"}, cfg.Discovery.Rules[0].Tags)
+	require.Equal(t, []string{"ongoing"}, cfg.Discovery.Rules[0].Status)
+	require.Equal(t, "^resolver", cfg.Discovery.Rules[0].Description)
+	require.True(t, cfg.Discovery.Rules[1].Mine)
+	require.Equal(t, Secret("secret"), cfg.Discovery.Rules[1].APIKey)
+}
+
+func TestValidation_DiscoveryRules(t *testing.T) {
+	for name, rule := range map[string]string{
+		"no filter":     "name: all",
+		"invalid regex": "description: \"(\"",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			yamlPath := filepath.Join(dir, "cfg.yaml")
+			require.NoError(t, os.WriteFile(yamlPath, []byte("discovery:\n  rules:\n    - "+rule+"\n"), 0o600))
+
+			fs := newFlagSet()
+			require.NoError(t, fs.Parse([]string{"--config.file=" + yamlPath}))
+			_, err := Load(fs)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	t.Setenv("ATLAS_ADMIN__TOKEN", "")
+
+	fs := newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--admin.enabled"}))
+	_, err := Load(fs)
+	require.Error(t, err)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenPath, []byte("admin-token\n"), 0o600))
+
+	fs = newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--admin.enabled", "--admin.token_file=" + tokenPath}))
+	cfg, err := Load(fs)
+	require.NoError(t, err)
+	require.Equal(t, Secret("admin-token"), cfg.Admin.Token)
+}
+
+func TestMeasurementOverrides(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "cfg.yaml")
+	err := os.WriteFile(yamlPath, []byte(`max_result_age: 30m
+histogram_buckets:
+  ping:
+    rtt: [10, 20]
+measurements:
+  - id: 123
+  - id: 456
+    filter_invalid_results: false
+    max_result_age: 5m
+    timeout: 10s
+    dns:
+      nsid_enabled: false
+    histogram_buckets:
+      ping:
+        rtt: [1, 2, 3]
+    labels:
+      team: netops
+`), 0o600)
+	require.NoError(t, err)
+
+	fs := newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--config.file=" + yamlPath}))
+	cfg, err := Load(fs)
+	require.NoError(t, err)
+
+	s := cfg.SettingsFor(cfg.Measurements[0])
+	require.True(t, s.FilterInvalidResults)
+	require.True(t, s.NSIDEnabled)
+	require.Equal(t, 30*time.Minute, s.MaxResultAge)
+	require.Zero(t, s.Retention, "retention must not fall back to max_result_age")
+	require.Equal(t, cfg.Timeout, s.Timeout)
+	require.Equal(t, []float64{10, 20}, s.HistogramBuckets.Ping.Rtt)
+	require.Empty(t, s.Labels)
+
+	s = cfg.SettingsFor(cfg.Measurements[1])
+	require.False(t, s.FilterInvalidResults)
+	require.False(t, s.NSIDEnabled)
+	require.Equal(t, 5*time.Minute, s.MaxResultAge)
+	require.Equal(t, 10*time.Second, s.Timeout)
+	require.Equal(t, []float64{1, 2, 3}, s.HistogramBuckets.Ping.Rtt)
+	require.Equal(t, map[string]string{"team": "netops"}, s.Labels)
+}
+
+func TestValidation_MeasurementOverrides(t *testing.T) {
+	for name, m := range map[string]string{
+		"reserved label":    "labels: {probe: x}",
+		"invalid label":     "labels: {\"my-label\": x}",
+		"invalid buckets":   "histogram_buckets: {ping: {rtt: [2, 1]}}",
+		"negative duration": "max_result_age: -1m",
+	} {
+		t.Run(name, func(t *testing.T) {
+			yamlPath := filepath.Join(t.TempDir(), "cfg.yaml")
+			require.NoError(t, os.WriteFile(yamlPath, []byte("measurements:\n  - id: 1\n    "+m+"\n"), 0o600))
+
+			fs := newFlagSet()
+			require.NoError(t, fs.Parse([]string{"--config.file=" + yamlPath}))
+			_, err := Load(fs)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLabelPolicy(t *testing.T) {
+	yamlPath := filepath.Join(t.TempDir(), "cfg.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`label_policy:
+  default:
+    drop: [lat, long]
+  dns:
+    add: [is_anchor, "tag:system-ipv6-works"]
+`), 0o600))
+
+	fs := newFlagSet()
+	require.NoError(t, fs.Parse([]string{"--config.file=" + yamlPath}))
+	cfg, err := Load(fs)
+	require.NoError(t, err)
+
+	s := cfg.SettingsFor(Measurement{ID: "1"})
+	require.Equal(t, []string{"lat", "long"}, s.LabelPolicy("ping").Drop)
+	require.Empty(t, s.LabelPolicy("dns").Drop)
+	require.Equal(t, []string{"is_anchor", "tag:system-ipv6-works"}, s.LabelPolicy("dns").Add)
+
+	for name, policy := range map[string]string{
+		"unknown type":  "foo: {drop: [lat]}",
+		"drop required": "ping: {drop: [probe]}",
+		"unknown label": "ping: {add: [hostname]}",
+		"empty tag":     "ping: {add: [\"tag:\"]}",
+		"same label":    "ping: {add: [\"tag:a-b\", \"tag:a_b\"]}",
+	} {
+		t.Run(name, func(t *testing.T) {
+			yamlPath := filepath.Join(t.TempDir(), "cfg.yaml")
+			require.NoError(t, os.WriteFile(yamlPath, []byte("label_policy:\n  "+policy+"\n"), 0o600))
+
+			fs := newFlagSet()
+			require.NoError(t, fs.Parse([]string{"--config.file=" + yamlPath}))
+			_, err := Load(fs)
+			require.Error(t, err)
+		})
+	}
+}
@@ -2,7 +2,11 @@
 
 package config
 
-import "time"
+import (
+	"regexp"
+	"strings"
+	"time"
+)
 
 // Config represents the full configuration for the exporter
 type Config struct {
@@ -12,28 +16,71 @@ type Config struct {
 	} `koanf:"web" yaml:"web"`
 
 	Cache struct {
-		TTL     time.Duration `koanf:"ttl" yaml:"ttl"`
-		Cleanup time.Duration `koanf:"cleanup" yaml:"cleanup"`
+		TTL          time.Duration `koanf:"ttl" yaml:"ttl"`
+		Cleanup      time.Duration `koanf:"cleanup" yaml:"cleanup"`
+		File         string        `koanf:"file" yaml:"file"`
+		SaveInterval time.Duration `koanf:"save_interval" yaml:"save_interval"`
+		StaleTTL     time.Duration `koanf:"stale_ttl" yaml:"stale_ttl"`
+		NegativeTTL  time.Duration `koanf:"negative_ttl" yaml:"negative_ttl"`
+		MaxSize      uint          `koanf:"max_size" yaml:"max_size"`
 	} `koanf:"cache" yaml:"cache"`
 
 	Timeout time.Duration `koanf:"timeout" yaml:"timeout"`
 
+	Atlas struct {
+		APIURL     string        `koanf:"api_url" yaml:"api_url"`
+		StreamURL  string        `koanf:"stream_url" yaml:"stream_url"`
+		ProxyURL   string        `koanf:"proxy_url" yaml:"proxy_url"`
+		CAFile     string        `koanf:"ca_file" yaml:"ca_file"`
+		APIKey     Secret        `koanf:"api_key" yaml:"api_key"`
+		APIKeyFile string        `koanf:"api_key_file" yaml:"api_key_file"`
+		Timeout    time.Duration `koanf:"timeout" yaml:"timeout"`
+		Retries    uint          `koanf:"retries" yaml:"retries"`
+		RateLimit  float64       `koanf:"rate_limit" yaml:"rate_limit"`
+		RateBurst  uint          `koanf:"rate_burst" yaml:"rate_burst"`
+	} `koanf:"atlas" yaml:"atlas"`
+
 	Worker struct {
 		Count uint `koanf:"count" yaml:"count"`
 	} `koanf:"worker" yaml:"worker"`
 
+	Probes struct {
+		BatchSize   uint          `koanf:"batch_size" yaml:"batch_size"`
+		BatchWindow time.Duration `koanf:"batch_window" yaml:"batch_window"`
+	} `koanf:"probes" yaml:"probes"`
+
 	Streaming struct {
-		Enabled    bool `koanf:"enabled" yaml:"enabled"`
-		BufferSize uint `koanf:"buffer_size" yaml:"buffer_size"`
+		Enabled     bool `koanf:"enabled" yaml:"enabled"`
+		BufferSize  uint `koanf:"buffer_size" yaml:"buffer_size"`
+		Backfill    bool `koanf:"backfill" yaml:"backfill"`
+		Connections uint `koanf:"connections" yaml:"connections"`
 	} `koanf:"streaming" yaml:"streaming"`
 
+	Replay struct {
+		Enabled    bool    `koanf:"enabled" yaml:"enabled"`
+		Path       string  `koanf:"path" yaml:"path"`
+		Speed      float64 `koanf:"speed" yaml:"speed"`
+		ProbesFile string  `koanf:"probes_file" yaml:"probes_file"`
+	} `koanf:"replay" yaml:"replay"`
+
+	Record struct {
+		Enabled        bool          `koanf:"enabled" yaml:"enabled"`
+		Path           string        `koanf:"path" yaml:"path"`
+		RotateInterval time.Duration `koanf:"rotate_interval" yaml:"rotate_interval"`
+		Compress       bool          `koanf:"compress" yaml:"compress"`
+		MaxAge         time.Duration `koanf:"max_age" yaml:"max_age"`
+		MaxSizeMB      uint          `koanf:"max_size_mb" yaml:"max_size_mb"`
+	} `koanf:"record" yaml:"record"`
+
 	Profiling struct {
 		Enabled bool `koanf:"enabled" yaml:"enabled"`
 	} `koanf:"profiling" yaml:"profiling"`
 
 	Metrics struct {
-		GoEnabled      bool `koanf:"go_enabled" yaml:"go_enabled"`
-		ProcessEnabled bool `koanf:"process_enabled" yaml:"process_enabled"`
+		GoEnabled              bool `koanf:"go_enabled" yaml:"go_enabled"`
+		ProcessEnabled         bool `koanf:"process_enabled" yaml:"process_enabled"`
+		MeasurementInfoEnabled bool `koanf:"measurement_info_enabled" yaml:"measurement_info_enabled"`
+		ProbeInfoEnabled       bool `koanf:"probe_info_enabled" yaml:"probe_info_enabled"`
 	} `koanf:"metrics" yaml:"metrics"`
 
 	Log struct {
@@ -50,10 +97,43 @@ type Config struct {
 		NSIDEnabled bool `koanf:"nsid_enabled" yaml:"nsid_enabled"`
 	} `koanf:"dns" yaml:"dns"`
 
+	Discovery struct {
+		Interval time.Duration   `koanf:"interval" yaml:"interval"`
+		Rules    []DiscoveryRule `koanf:"rules" yaml:"rules"`
+	} `koanf:"discovery" yaml:"discovery"`
+
+	Admin struct {
+		Enabled   bool   `koanf:"enabled" yaml:"enabled"`
+		Token     Secret `koanf:"token" yaml:"token"`
+		TokenFile string `koanf:"token_file" yaml:"token_file"`
+	} `koanf:"admin" yaml:"admin"`
+
+	Reload struct {
+		Watch bool `koanf:"watch" yaml:"watch"`
+	} `koanf:"reload" yaml:"reload"`
+
 	Health struct {
-		MaxDataAge time.Duration `koanf:"max_data_age" yaml:"max_data_age"`
+		MaxDataAge          time.Duration `koanf:"max_data_age" yaml:"max_data_age"`
+		MinConnectedPercent uint          `koanf:"min_connected_percent" yaml:"min_connected_percent"`
+		IntervalFactor      float64       `koanf:"interval_factor" yaml:"interval_factor"`
+		MinFreshPercent     uint          `koanf:"min_fresh_percent" yaml:"min_fresh_percent"`
+		APISuccessMaxAge    time.Duration `koanf:"api_success_max_age" yaml:"api_success_max_age"`
 	} `koanf:"health" yaml:"health"`
 
+	Results struct {
+		Retention time.Duration `koanf:"retention" yaml:"retention"`
+		MaxProbes uint          `koanf:"max_probes" yaml:"max_probes"`
+	} `koanf:"results" yaml:"results"`
+
+	Series struct {
+		MaxPerMeasurement uint  `koanf:"max_per_measurement" yaml:"max_per_measurement"`
+		MaxTotal          uint  `koanf:"max_total" yaml:"max_total"`
+		PriorityProbes    []int `koanf:"priority_probes" yaml:"priority_probes"`
+	} `koanf:"series" yaml:"series"`
+
+	// LabelPolicies select the probe labels of result metrics per measurement type (or "default" for all types)
+	LabelPolicies map[string]LabelPolicy `koanf:"label_policy" yaml:"label_policy"`
+
 	// Existing config fields preserved and names aligned to new schema
 	HistogramBuckets HistogramBuckets `koanf:"histogram_buckets" yaml:"histogram_buckets"`
 	Measurements     []Measurement    `koanf:"measurements" yaml:"measurements"`
@@ -76,9 +156,111 @@ type RttHistogramBucket struct {
 	Rtt []float64 `yaml:"rtt" koanf:"rtt"`
 }
 
-// Measurement represents config options for one measurement
+// DefaultProbeLabels are the labels derived from the probe which result metrics have without label policy
+var DefaultProbeLabels = []string{"asn", "country_code", "lat", "long"}
+
+// OptionalProbeLabels are the probe attributes which can be added as labels to result metrics.
+// Besides these, tags of the probe can be added using "tag:<slug>".
+var OptionalProbeLabels = []string{"is_anchor", "is_public", "prefix", "firmware_version", "status"}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// ProbeLabelName returns the name of the label of a probe attribute, e.g. tag_system_ipv6_works for tag:system-ipv6-works
+func ProbeLabelName(attr string) string {
+	if tag, found := strings.CutPrefix(attr, "tag:"); found {
+		return "tag_" + invalidLabelChars.ReplaceAllString(tag, "_")
+	}
+
+	return attr
+}
+
+// LabelPolicy selects the labels derived from the probe for result metrics
+type LabelPolicy struct {
+	// Drop removes labels of DefaultProbeLabels
+	Drop []string `yaml:"drop" koanf:"drop"`
+	// Add adds labels of OptionalProbeLabels or probe tags ("tag:<slug>", exported as label tag_<slug>)
+	Add []string `yaml:"add" koanf:"add"`
+}
+
+// Measurement represents config options for one measurement. Options not set fall back to the global settings.
 type Measurement struct {
 	ID string `yaml:"id" koanf:"id"`
+	// APIKey overrides the global API key, e.g. for measurements owned by a different account
+	APIKey Secret `yaml:"api_key" koanf:"api_key"`
+	// HistogramBuckets overrides the buckets of the RTT histograms (per type)
+	HistogramBuckets HistogramBuckets `yaml:"histogram_buckets" koanf:"histogram_buckets"`
+	// FilterInvalidResults overrides filtering of invalid results
+	FilterInvalidResults *bool `yaml:"filter_invalid_results" koanf:"filter_invalid_results"`
+	// MaxResultAge overrides the maximum age of results exported
+	MaxResultAge *time.Duration `yaml:"max_result_age" koanf:"max_result_age"`
+	DNS          struct {
+		// NSIDEnabled overrides the NSID label of DNS measurements
+		NSIDEnabled *bool `yaml:"nsid_enabled" koanf:"nsid_enabled"`
+	} `yaml:"dns" koanf:"dns"`
+	// Timeout limits the time to retrieve the results of the measurement in request mode
+	Timeout time.Duration `yaml:"timeout" koanf:"timeout"`
+	// Labels are added as constant labels to all metrics of the measurement
+	Labels map[string]string `yaml:"labels" koanf:"labels"`
+}
+
+// MeasurementSettings are the settings a measurement is exported with (global settings merged with the overrides of the measurement)
+type MeasurementSettings struct {
+	HistogramBuckets     HistogramBuckets
+	FilterInvalidResults bool
+	MaxResultAge         time.Duration
+	Retention            time.Duration
+	MaxProbes            int
+	NSIDEnabled          bool
+	Timeout              time.Duration
+	Labels               map[string]string
+	LabelPolicies        map[string]LabelPolicy
+}
+
+// LabelPolicy returns the label policy for measurements of type t
+func (s MeasurementSettings) LabelPolicy(t string) LabelPolicy {
+	if p, found := s.LabelPolicies[t]; found {
+		return p
+	}
+
+	return s.LabelPolicies["default"]
+}
+
+// DiscoveryRule selects measurements by querying the Atlas measurements API.
+// All filters set have to match.
+type DiscoveryRule struct {
+	// Name identifies the rule in logs and metrics (default: index of the rule)
+	Name string `yaml:"name" koanf:"name"`
+	// Tags the measurements have to be tagged with (all of them)
+	Tags []string `yaml:"tags" koanf:"tags"`
+	// Type of the measurements (ping, traceroute, dns, http, sslcert, ntp)
+	Type string `yaml:"type" koanf:"type"`
+	// Status of the measurements (e.g. ongoing, scheduled, stopped)
+	Status []string `yaml:"status" koanf:"status"`
+	// Target host name or IP address of the measurements
+	Target string `yaml:"target" koanf:"target"`
+	// Description is a regular expression matched against the measurement descriptions
+	Description string `yaml:"description" koanf:"description"`
+	// Mine restricts the measurements to the ones owned by the account of the API key
+	Mine bool `yaml:"mine" koanf:"mine"`
+	// APIKey overrides the global API key for the query and the discovered measurements
+	APIKey Secret `yaml:"api_key" koanf:"api_key"`
+}
+
+// Secret is a string value which is redacted when printed (e.g. API keys)
+type Secret string
+
+// String implements fmt.Stringer
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return "<redacted>"
+}
+
+// GoString implements fmt.GoStringer
+func (s Secret) GoString() string {
+	return s.String()
 }
 
 // MeasurementIDs represents all IDs of configured measurements
@@ -89,3 +271,73 @@ func (c *Config) MeasurementIDs() []string {
 	}
 	return ids
 }
+
+// MeasurementByID returns the config of the measurement with the given ID
+func (c *Config) MeasurementByID(id string) (Measurement, bool) {
+	for _, m := range c.Measurements {
+		if m.ID == id {
+			return m, true
+		}
+	}
+
+	return Measurement{}, false
+}
+
+// APIKeyFor returns the API key to use for requests regarding a measurement
+func (c *Config) APIKeyFor(id string) Secret {
+	if m, found := c.MeasurementByID(id); found && m.APIKey != "" {
+		return m.APIKey
+	}
+
+	return c.Atlas.APIKey
+}
+
+// SettingsFor returns the settings of the measurement merged with the global settings
+func (c *Config) SettingsFor(m Measurement) MeasurementSettings {
+	s := MeasurementSettings{
+		HistogramBuckets:     c.HistogramBuckets,
+		FilterInvalidResults: c.FilterInvalidResults,
+		MaxResultAge:         c.MaxResultAge,
+		Retention:            c.Results.Retention,
+		MaxProbes:            int(c.Results.MaxProbes),
+		NSIDEnabled:          c.DNS.NSIDEnabled,
+		Timeout:              c.Timeout,
+		Labels:               m.Labels,
+		LabelPolicies:        c.LabelPolicies,
+	}
+
+	b := m.HistogramBuckets
+	if b.DNS.Rtt != nil {
+		s.HistogramBuckets.DNS = b.DNS
+	}
+	if b.HTTP.Rtt != nil {
+		s.HistogramBuckets.HTTP = b.HTTP
+	}
+	if b.Ping.Rtt != nil {
+		s.HistogramBuckets.Ping = b.Ping
+	}
+	if b.Traceroute.Rtt != nil {
+		s.HistogramBuckets.Traceroute = b.Traceroute
+	}
+
+	if m.FilterInvalidResults != nil {
+		s.FilterInvalidResults = *m.FilterInvalidResults
+	}
+	if m.MaxResultAge != nil {
+		s.MaxResultAge = *m.MaxResultAge
+	}
+	if m.DNS.NSIDEnabled != nil {
+		s.NSIDEnabled = *m.DNS.NSIDEnabled
+	}
+	if m.Timeout > 0 {
+		s.Timeout = m.Timeout
+	}
+
+	return s
+}
+
+// SettingsForID returns the settings of a configured measurement (global settings if the measurement is not configured)
+func (c *Config) SettingsForID(id string) MeasurementSettings {
+	m, _ := c.MeasurementByID(id)
+	return c.SettingsFor(m)
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/knadh/koanf/providers/file"
+)
+
+// watchDelay coalesces the events of a single save (e.g. truncate and write) into one reload
+const watchDelay = 500 * time.Millisecond
+
+// Watch calls f whenever the config file at path changes until ctx is done.
+// Replacing the file by a symlink change (e.g. Kubernetes ConfigMap) is detected as well.
+// If watching fails (e.g. the file was removed) f is called with the error and watching stops.
+func Watch(ctx context.Context, path string, f func(err error)) error {
+	p := file.Provider(path)
+	changed := make(chan struct{}, 1)
+
+	err := p.Watch(func(_ any, err error) {
+		if err != nil {
+			f(err)
+			return
+		}
+
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer func() { _ = p.Unwatch() }()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchDelay):
+			}
+
+			// drop events of the same save
+			select {
+			case <-changed:
+			default:
+			}
+
+			f(nil)
+		}
+	}()
+
+	return nil
+}
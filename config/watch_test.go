@@ -0,0 +1,39 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cfg.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("measurements: []\n"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan error, 10)
+	require.NoError(t, Watch(ctx, path, func(err error) { changed <- err }))
+
+	require.NoError(t, os.WriteFile(path, []byte("measurements:\n  - id: 1\n"), 0o600))
+
+	select {
+	case err := <-changed:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected change of config file to be reported")
+	}
+
+	// events of a single save are coalesced
+	select {
+	case <-changed:
+		t.Fatal("expected a single notification")
+	case <-time.After(2 * watchDelay):
+	}
+}
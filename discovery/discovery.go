@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/api"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// statusIDs maps status names to the IDs used by the measurements API
+var statusIDs = map[string]int{
+	"specified":          0,
+	"scheduled":          1,
+	"ongoing":            2,
+	"stopped":            4,
+	"forced_to_stop":     5,
+	"no_suitable_probes": 6,
+	"failed":             7,
+	"denied":             8,
+	"canceled":           9,
+}
+
+var types = []string{"ping", "traceroute", "dns", "http", "sslcert", "ntp"}
+
+// DiscoveredGauge tracks the number of measurements matching each discovery rule
+var DiscoveredGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "atlas_exporter_discovered_measurements",
+		Help: "Number of measurements matching a discovery rule",
+	},
+	[]string{"rule"},
+)
+
+type rule struct {
+	name        string
+	query       url.Values
+	description *regexp.Regexp
+	key         config.Secret
+}
+
+// Discoverer resolves discovery rules against the Atlas measurements API
+type Discoverer struct {
+	client   *api.Client
+	rules    []*rule
+	interval time.Duration
+	last     map[string][]config.Measurement
+}
+
+// New returns a discoverer for the rules configured in cfg
+func New(client *api.Client, cfg *config.Config) (*Discoverer, error) {
+	d := &Discoverer{
+		client:   client,
+		interval: cfg.Discovery.Interval,
+		last:     make(map[string][]config.Measurement),
+	}
+
+	for i, r := range cfg.Discovery.Rules {
+		rl, err := newRule(i, r)
+		if err != nil {
+			return nil, err
+		}
+
+		d.rules = append(d.rules, rl)
+	}
+
+	return d, nil
+}
+
+func newRule(i int, r config.DiscoveryRule) (*rule, error) {
+	rl := &rule{
+		name:  r.Name,
+		query: url.Values{},
+		key:   r.APIKey,
+	}
+	if rl.name == "" {
+		rl.name = strconv.Itoa(i)
+	}
+
+	if len(r.Tags) > 0 {
+		rl.query.Set("tags", strings.Join(r.Tags, ","))
+	}
+
+	if r.Type != "" {
+		t := strings.ToLower(r.Type)
+		if !slices.Contains(types, t) {
+			return nil, fmt.Errorf("discovery rule %s: unsupported type %s", rl.name, r.Type)
+		}
+		rl.query.Set("type", t)
+	}
+
+	if len(r.Status) > 0 {
+		ids := make([]string, 0, len(r.Status))
+		for _, s := range r.Status {
+			id, found := statusIDs[strings.ReplaceAll(strings.ToLower(s), " ", "_")]
+			if !found {
+				return nil, fmt.Errorf("discovery rule %s: unknown status %s", rl.name, s)
+			}
+			ids = append(ids, strconv.Itoa(id))
+		}
+		rl.query.Set("status__in", strings.Join(ids, ","))
+	}
+
+	if r.Target != "" {
+		rl.query.Set("target", r.Target)
+	}
+
+	if r.Mine {
+		rl.query.Set("mine", "true")
+	}
+
+	if r.Description != "" {
+		re, err := regexp.Compile(r.Description)
+		if err != nil {
+			return nil, fmt.Errorf("discovery rule %s: %w", rl.name, err)
+		}
+		rl.description = re
+	}
+
+	return rl, nil
+}
+
+// Run resolves the rules immediately and then periodically, passing the discovered measurements to f.
+// When ctx is done the number of measurements discovered by the rules is no longer exported.
+func (d *Discoverer) Run(ctx context.Context, f func([]config.Measurement)) {
+	defer func() {
+		for _, r := range d.rules {
+			DiscoveredGauge.DeleteLabelValues(r.name)
+		}
+	}()
+
+	f(d.Discover(ctx))
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f(d.Discover(ctx))
+		}
+	}
+}
+
+// Discover resolves all rules and returns the matching measurements ordered by ID.
+// When a rule can not be resolved the measurements of its last successful resolution are kept,
+// so an API outage does not unsubscribe measurements.
+func (d *Discoverer) Discover(ctx context.Context) []config.Measurement {
+	seen := make(map[string]bool)
+	res := make([]config.Measurement, 0)
+
+	for _, r := range d.rules {
+		ms, err := d.resolve(ctx, r)
+		if err != nil {
+			log.Errorf("could not resolve discovery rule %s, keeping %d measurements: %v", r.name, len(d.last[r.name]), err)
+			ms = d.last[r.name]
+		} else {
+			d.last[r.name] = ms
+			DiscoveredGauge.WithLabelValues(r.name).Set(float64(len(ms)))
+		}
+
+		for _, m := range ms {
+			if seen[m.ID] {
+				continue
+			}
+
+			seen[m.ID] = true
+			res = append(res, m)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		a, _ := strconv.Atoi(res[i].ID)
+		b, _ := strconv.Atoi(res[j].ID)
+		return a < b
+	})
+
+	return res
+}
+
+func (d *Discoverer) resolve(ctx context.Context, r *rule) ([]config.Measurement, error) {
+	found, err := d.client.WithKey(r.key).WithContext(ctx).SearchMeasurements(r.query)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := make([]config.Measurement, 0, len(found))
+	for _, m := range found {
+		if r.description != nil && !r.description.MatchString(m.Description) {
+			continue
+		}
+
+		ms = append(ms, config.Measurement{
+			ID:     strconv.Itoa(m.ID),
+			APIKey: r.key,
+		})
+	}
+
+	log.Debugf("Discovery rule %s matched %d measurements", r.name, len(ms))
+	return ms, nil
+}
@@ -0,0 +1,112 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/api"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDiscoverer(t *testing.T, h http.HandlerFunc, rules ...config.DiscoveryRule) *Discoverer {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{}
+	cfg.Atlas.APIURL = srv.URL
+	cfg.Discovery.Rules = rules
+
+	c, err := api.NewClient(cfg)
+	require.NoError(t, err)
+
+	d, err := New(c, cfg)
+	require.NoError(t, err)
+	return d
+}
+
+func TestDiscover(t *testing.T) {
+	d := newTestDiscoverer(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("tags") == "anycast" {
+			require.Equal(t, "ping", q.Get("type"))
+			require.Equal(t, "1,2", q.Get("status__in"))
+			_, _ = w.Write([]byte(`{"results":[{"id":30,"description":"edge anycast"},{"id":10,"description":"core anycast"},{"id":20,"description":"lab"}]}`))
+			return
+		}
+
+		require.Equal(t, "true", q.Get("mine"))
+		_, _ = w.Write([]byte(`{"results":[{"id":10},{"id":40}]}`))
+	},
+		config.DiscoveryRule{Tags: []string{"anycast"}, Type: "ping", Status: []string{"scheduled", "Ongoing"}, Description: "anycast$"},
+		config.DiscoveryRule{Mine: true, APIKey: "secret"},
+	)
+
+	ms := d.Discover(context.Background())
+	ids := make([]string, len(ms))
+	for i, m := range ms {
+		ids[i] = m.ID
+	}
+
+	require.Equal(t, []string{"10", "30", "40"}, ids)
+	require.Equal(t, config.Secret(""), ms[0].APIKey, "first matching rule wins")
+	require.Equal(t, config.Secret("secret"), ms[2].APIKey)
+}
+
+func TestDiscover_KeepsResultsOnError(t *testing.T) {
+	var fail atomic.Bool
+	d := newTestDiscoverer(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"results":[{"id":10}]}`))
+	}, config.DiscoveryRule{Name: "dns", Type: "dns"})
+
+	require.Len(t, d.Discover(context.Background()), 1)
+
+	fail.Store(true)
+	require.Len(t, d.Discover(context.Background()), 1)
+}
+
+func TestRun_RemovesGaugeOnStop(t *testing.T) {
+	d := newTestDiscoverer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"results":[{"id":10},{"id":20}]}`))
+	}, config.DiscoveryRule{Name: "anycast"})
+	d.interval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	discovered := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx, func([]config.Measurement) { close(discovered) })
+	}()
+
+	<-discovered
+	require.Equal(t, 2.0, testutil.ToFloat64(DiscoveredGauge.WithLabelValues("anycast")))
+
+	cancel()
+	<-done
+	require.False(t, DiscoveredGauge.DeleteLabelValues("anycast"), "gauge of stopped discovery should be removed")
+}
+
+func TestNew_InvalidRule(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Discovery.Rules = []config.DiscoveryRule{{Status: []string{"running"}}}
+
+	_, err := New(nil, cfg)
+	require.Error(t, err)
+
+	cfg.Discovery.Rules = []config.DiscoveryRule{{Type: "whois"}}
+	_, err = New(nil, cfg)
+	require.Error(t, err)
+}
@@ -8,27 +8,30 @@ import (
 
 	"github.com/DNS-OARC/ripeatlas/measurement"
 	"github.com/DNS-OARC/ripeatlas/measurement/dns"
+	"github.com/czerwonk/atlas_exporter/exporter"
 	"github.com/czerwonk/atlas_exporter/probe"
 	mdns "github.com/miekg/dns"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-var (
-	labels      []string
+type dnsExporter struct {
+	id          string
+	nsidEnabled bool
+	probeLabels *exporter.ProbeLabels
 	successDesc *prometheus.Desc
 	rttDesc     *prometheus.Desc
-)
-
-func init() {
-	labels = []string{"measurement", "probe", "dst_addr", "asn", "ip_version", "country_code", "lat", "long", "nsid"}
-
-	successDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "success"), "Destination was reachable", labels, nil)
-	rttDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "rtt"), "Roundtrip time in ms", labels, nil)
 }
 
-type dnsExporter struct {
-	id          string
-	nsidEnabled bool
+func newDNSExporter(id string, nsidEnabled bool, probeLabels *exporter.ProbeLabels) *dnsExporter {
+	labels := append([]string{"measurement", "probe", "dst_addr", "ip_version", "nsid"}, probeLabels.Names()...)
+
+	return &dnsExporter{
+		id:          id,
+		nsidEnabled: nsidEnabled,
+		probeLabels: probeLabels,
+		successDesc: prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "success"), "Destination was reachable", labels, nil),
+		rttDesc:     prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "rtt"), "Roundtrip time in ms", labels, nil),
+	}
 }
 
 // Export exports a prometheus metric
@@ -44,13 +47,10 @@ func (m *dnsExporter) Export(res *measurement.Result, probe *probe.Probe, ch cha
 		m.id,
 		strconv.Itoa(probe.ID),
 		res.DstAddr(),
-		strconv.Itoa(probe.ASNForIPVersion(res.Af())),
 		strconv.Itoa(res.Af()),
-		probe.CountryCode,
-		probe.Latitude(),
-		probe.Longitude(),
 		nsid,
 	}
+	labelValues = append(labelValues, m.probeLabels.Values(probe, res.Af())...)
 
 	var rtt float64
 	if res.DnsResult() != nil {
@@ -58,17 +58,17 @@ func (m *dnsExporter) Export(res *measurement.Result, probe *probe.Probe, ch cha
 	}
 
 	if rtt > 0 {
-		ch <- prometheus.MustNewConstMetric(successDesc, prometheus.GaugeValue, 1, labelValues...)
-		ch <- prometheus.MustNewConstMetric(rttDesc, prometheus.GaugeValue, rtt, labelValues...)
+		ch <- prometheus.MustNewConstMetric(m.successDesc, prometheus.GaugeValue, 1, labelValues...)
+		ch <- prometheus.MustNewConstMetric(m.rttDesc, prometheus.GaugeValue, rtt, labelValues...)
 	} else {
-		ch <- prometheus.MustNewConstMetric(successDesc, prometheus.GaugeValue, 0, labelValues...)
+		ch <- prometheus.MustNewConstMetric(m.successDesc, prometheus.GaugeValue, 0, labelValues...)
 	}
 }
 
 // Describe exports metric descriptions for Prometheus
 func (m *dnsExporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- successDesc
-	ch <- rttDesc
+	ch <- m.successDesc
+	ch <- m.rttDesc
 }
 
 // extractNsid extracts NSID from DNS result using UnpackAbuf
@@ -13,5 +13,10 @@ type DefaultResultValidator struct {
 
 // IsValid returns whether an result is valid or not (e.g. IPv6 measurement and Probe does not support IPv6)
 func (m *DefaultResultValidator) IsValid(res *measurement.Result, probe *probe.Probe) bool {
+	// results are kept until the information of the probe is known
+	if probe.Placeholder {
+		return true
+	}
+
 	return probe.ASNForIPVersion(res.Af()) > 0
 }
@@ -3,6 +3,8 @@
 package exporter
 
 import (
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -35,15 +37,52 @@ func WithMaxResultAge(age time.Duration) MeasurementOpt {
 	}
 }
 
+// WithLabels adds constant labels to all metrics of the measurement
+func WithLabels(labels map[string]string) MeasurementOpt {
+	return func(r *Measurement) {
+		r.labels = labels
+	}
+}
+
+// WithRetention sets the age after which results are removed by Expire
+func WithRetention(d time.Duration) MeasurementOpt {
+	return func(r *Measurement) {
+		r.retention = d
+	}
+}
+
+// WithMaxProbes limits the number of probes results are held for. When exceeded the oldest result is removed.
+func WithMaxProbes(n int) MeasurementOpt {
+	return func(r *Measurement) {
+		r.maxProbes = n
+	}
+}
+
+// Stats are statistics of the results added to a measurement
+type Stats struct {
+	// Type is the type of the latest result accepted
+	Type string
+	// AF is the address family of the latest result accepted
+	AF int
+	// Dropped is the number of results dropped by reason
+	Dropped map[string]int
+}
+
 // Measurement handles measurement results and converts to metrics
 type Measurement struct {
 	mu           sync.RWMutex
 	latest       map[int]*measurement.Result
 	probes       map[int]*probe.Probe
+	dropped      map[string]int
+	resultType   string
+	af           int
 	histograms   []Histogram
 	exporter     Exporter
 	validator    ResultValidator
 	maxResultAge time.Duration
+	retention    time.Duration
+	maxProbes    int
+	labels       prometheus.Labels
 }
 
 // NewMeasurement returns a new instance of `Measurement`
@@ -51,6 +90,7 @@ func NewMeasurement(exporter Exporter, opts ...MeasurementOpt) *Measurement {
 	r := &Measurement{
 		latest:     make(map[int]*measurement.Result),
 		probes:     make(map[int]*probe.Probe),
+		dropped:    make(map[string]int),
 		histograms: make([]Histogram, 0),
 		exporter:   exporter,
 	}
@@ -62,24 +102,233 @@ func NewMeasurement(exporter Exporter, opts ...MeasurementOpt) *Measurement {
 	return r
 }
 
-// Add adds an result to a measurement
+// Add adds an result to a measurement. Invalid results and results not newer than the latest result of the probe
+// (e.g. resent after a reconnect or also retrieved by backfill) are dropped. Results older than the max. result age
+// are still observed by histograms but not exported.
 func (r *Measurement) Add(m *measurement.Result, probe *probe.Probe) {
-	if r.validator != nil && !r.validator.IsValid(m, probe) {
+	ResultReceived(m)
+
+	if reason := r.add(m, probe); reason != "" {
+		ResultDropped(m, reason)
+
+		r.mu.Lock()
+		r.dropped[reason]++
+		r.mu.Unlock()
 		return
 	}
 
+	ResultsAcceptedCounter.WithLabelValues(strconv.Itoa(m.MsmId()), m.Type()).Inc()
+}
+
+// add adds the result, returning the reason if it was dropped
+func (r *Measurement) add(m *measurement.Result, probe *probe.Probe) string {
+	if r.validator != nil && !r.validator.IsValid(m, probe) {
+		return "invalid"
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
+
+	prev, found := r.latest[m.PrbId()]
+	if found && m.Timestamp() <= prev.Timestamp() {
+		if m.Timestamp() == prev.Timestamp() {
+			return "duplicate"
+		}
+		return "out_of_order"
+	}
+
+	if !found && r.maxProbes > 0 && len(r.latest) >= r.maxProbes {
+		oldest := r.oldest()
+		if m.Timestamp() <= oldest.Timestamp() {
+			return "max_probes"
+		}
+
+		r.remove(oldest, "max_probes")
+	}
+
 	r.latest[m.PrbId()] = m
 	r.probes[m.PrbId()] = probe
+	r.resultType = m.Type()
+	r.af = m.Af()
 
 	for _, h := range r.histograms {
 		h.ProcessResult(m)
 	}
+
+	return ""
+}
+
+// oldest returns the oldest result held. r.mu has to be held.
+func (r *Measurement) oldest() *measurement.Result {
+	var oldest *measurement.Result
+	for _, v := range r.latest {
+		if oldest == nil || v.Timestamp() < oldest.Timestamp() {
+			oldest = v
+		}
+	}
+
+	return oldest
+}
+
+// remove removes the result and counts it as evicted. r.mu has to be held.
+func (r *Measurement) remove(m *measurement.Result, reason string) {
+	delete(r.latest, m.PrbId())
+	delete(r.probes, m.PrbId())
+	ResultsEvictedCounter.WithLabelValues(strconv.Itoa(m.MsmId()), m.Type(), reason).Inc()
+}
+
+// Expire removes results older than the retention and returns the number of results removed
+func (r *Measurement) Expire() int {
+	if r.retention <= 0 {
+		return 0
+	}
+
+	cutoff := int(time.Now().Add(-r.retention).Unix())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := 0
+	for _, v := range r.latest {
+		if v.Timestamp() < cutoff {
+			r.remove(v, "retention")
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// UpdateProbe replaces the information of a probe results are held for (e.g. a placeholder once the probe
+// could be retrieved). The result is removed if it is not valid for the probe.
+func (r *Measurement) UpdateProbe(p *probe.Probe) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, found := r.latest[p.ID]
+	if !found {
+		return
+	}
+
+	if r.validator != nil && !r.validator.IsValid(m, p) {
+		delete(r.latest, p.ID)
+		delete(r.probes, p.ID)
+		return
+	}
+
+	r.probes[p.ID] = p
+}
+
+// LatestTimestamp returns the timestamp of the latest result held for a probe
+func (r *Measurement) LatestTimestamp(probeID int) (int, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, found := r.latest[probeID]
+	if !found {
+		return 0, false
+	}
+
+	return m.Timestamp(), true
+}
+
+// ProbeCount returns the number of probes results are held for
+func (r *Measurement) ProbeCount() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.latest)
+}
+
+// Stats returns statistics of the results added
+func (r *Measurement) Stats() Stats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	dropped := make(map[string]int, len(r.dropped))
+	for k, v := range r.dropped {
+		dropped[k] = v
+	}
+
+	return Stats{
+		Type:    r.resultType,
+		AF:      r.af,
+		Dropped: dropped,
+	}
+}
+
+// Probes returns the probes results are held for
+func (r *Measurement) Probes() []*probe.Probe {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	probes := make([]*probe.Probe, 0, len(r.probes))
+	for _, p := range r.probes {
+		probes = append(probes, p)
+	}
+
+	return probes
+}
+
+// Results returns the latest result of each probe
+func (r *Measurement) Results() []*measurement.Result {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := make([]*measurement.Result, 0, len(r.latest))
+	for _, v := range r.latest {
+		results = append(results, v)
+	}
+
+	return results
+}
+
+// CopyTo adds the latest result of each probe to another measurement (e.g. built with different options)
+func (r *Measurement) CopyTo(m *Measurement) {
+	r.mu.RLock()
+	results := make([]*measurement.Result, 0, len(r.latest))
+	for _, v := range r.latest {
+		results = append(results, v)
+	}
+	probes := make(map[int]*probe.Probe, len(r.probes))
+	for k, v := range r.probes {
+		probes[k] = v
+	}
+	r.mu.RUnlock()
+
+	dropped := r.Stats().Dropped
+	m.mu.Lock()
+	for k, v := range dropped {
+		m.dropped[k] += v
+	}
+	m.mu.Unlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Timestamp() < results[j].Timestamp()
+	})
+
+	// results were counted when added to r already
+	for _, v := range results {
+		m.add(v, probes[v.PrbId()])
+	}
+}
+
+// HasLabels returns true if custom labels are added to all metrics of the measurement
+func (r *Measurement) HasLabels() bool {
+	return len(r.labels) > 0
 }
 
 // Describe describes all metrics for the `Measurement`
 func (r *Measurement) Describe(ch chan<- *prometheus.Desc) {
+	if len(r.labels) > 0 {
+		prometheus.WrapCollectorWith(r.labels, unlabeled{r}).Describe(ch)
+		return
+	}
+
+	r.describe(ch)
+}
+
+func (r *Measurement) describe(ch chan<- *prometheus.Desc) {
 	r.exporter.Describe(ch)
 
 	for _, h := range r.histograms {
@@ -89,6 +338,15 @@ func (r *Measurement) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect collects metrics for the `Measurement`
 func (r *Measurement) Collect(ch chan<- prometheus.Metric) {
+	if len(r.labels) > 0 {
+		prometheus.WrapCollectorWith(r.labels, unlabeled{r}).Collect(ch)
+		return
+	}
+
+	r.collect(ch)
+}
+
+func (r *Measurement) collect(ch chan<- prometheus.Metric) {
 	r.mu.RLock()
 	// snapshot keys to avoid holding lock while exporting
 	results := make([]*measurement.Result, 0, len(r.latest))
@@ -116,3 +374,16 @@ func (r *Measurement) Collect(ch chan<- prometheus.Metric) {
 		h.Hist().Collect(ch)
 	}
 }
+
+// unlabeled collects the metrics of a measurement without its constant labels
+type unlabeled struct {
+	m *Measurement
+}
+
+func (u unlabeled) Describe(ch chan<- *prometheus.Desc) {
+	u.m.describe(ch)
+}
+
+func (u unlabeled) Collect(ch chan<- prometheus.Metric) {
+	u.m.collect(ch)
+}
@@ -0,0 +1,174 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	mdms "github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/czerwonk/atlas_exporter/probe"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type countingHistogram struct {
+	prometheus.Histogram
+	results int
+}
+
+func (h *countingHistogram) ProcessResult(*mdms.Result) { h.results++ }
+func (h *countingHistogram) Hist() prometheus.Histogram { return h.Histogram }
+
+func result(t *testing.T, ts int) *mdms.Result {
+	t.Helper()
+
+	res := &mdms.Result{}
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`{"msm_id":1002,"prb_id":5,"af":4,"type":"ping","timestamp":%d}`, ts)), res); err != nil {
+		t.Fatalf("could not parse result: %v", err)
+	}
+
+	return res
+}
+
+func TestMeasurementDeduplication(t *testing.T) {
+	h := &countingHistogram{}
+	m := NewMeasurement(dummyExporter{}, WithHistograms(h))
+	p := &probe.Probe{ID: 5}
+
+	for _, ts := range []int{100, 100, 50, 200} {
+		m.Add(result(t, ts), p)
+	}
+
+	if h.results != 2 {
+		t.Fatalf("expected 2 results to be observed, got %d", h.results)
+	}
+
+	if ts := m.Results()[0].Timestamp(); ts != 200 {
+		t.Fatalf("expected latest result with timestamp 200, got %d", ts)
+	}
+
+	if v := testutil.ToFloat64(ResultsAcceptedCounter.WithLabelValues("1002", "ping")); v != 2 {
+		t.Fatalf("expected 2 accepted results, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(ResultsDroppedCounter.WithLabelValues("1002", "ping", "duplicate")); v != 1 {
+		t.Fatalf("expected 1 duplicate, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(ResultsDroppedCounter.WithLabelValues("1002", "ping", "out_of_order")); v != 1 {
+		t.Fatalf("expected 1 out of order result, got %v", v)
+	}
+
+	if st := m.Stats(); st.Type != "ping" || st.AF != 4 || st.Dropped["duplicate"] != 1 || st.Dropped["out_of_order"] != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestMeasurementPlaceholderProbe(t *testing.T) {
+	res := &mdms.Result{}
+	if err := json.Unmarshal([]byte(`{"msm_id":1001,"prb_id":5,"af":4,"type":"ping"}`), res); err != nil {
+		t.Fatalf("could not parse result: %v", err)
+	}
+
+	m := NewMeasurement(dummyExporter{}, WithValidator(&DefaultResultValidator{}))
+
+	// results of probes without information are kept until the probe is known
+	m.Add(res, probe.NewPlaceholder(5))
+	if m.ProbeCount() != 1 {
+		t.Fatalf("expected result with placeholder probe to be held")
+	}
+
+	m.UpdateProbe(&probe.Probe{ID: 5, Asn4: 3320})
+	if p := m.Probes()[0]; p.Placeholder || p.Asn4 != 3320 {
+		t.Fatalf("expected placeholder to be replaced, got %+v", p)
+	}
+
+	// invalid for the probe retrieved
+	m.UpdateProbe(&probe.Probe{ID: 5})
+	if m.ProbeCount() != 0 {
+		t.Fatalf("expected result invalid for the probe to be removed")
+	}
+}
+
+func TestMeasurementExpire(t *testing.T) {
+	m := NewMeasurement(dummyExporter{}, WithRetention(time.Hour))
+	now := int(time.Now().Unix())
+
+	m.Add(probeResult(t, 5, now-7200), &probe.Probe{ID: 5})
+	m.Add(probeResult(t, 6, now), &probe.Probe{ID: 6})
+
+	if n := m.Expire(); n != 1 {
+		t.Fatalf("expected 1 result to be removed, got %d", n)
+	}
+
+	if _, found := m.LatestTimestamp(5); found {
+		t.Fatalf("expected result of probe 5 to be removed")
+	}
+
+	if v := testutil.ToFloat64(ResultsEvictedCounter.WithLabelValues("1003", "ping", "retention")); v != 1 {
+		t.Fatalf("expected 1 evicted result, got %v", v)
+	}
+}
+
+func TestMeasurementMaxProbes(t *testing.T) {
+	m := NewMeasurement(dummyExporter{}, WithMaxProbes(2))
+
+	m.Add(probeResult(t, 1, 100), &probe.Probe{ID: 1})
+	m.Add(probeResult(t, 2, 200), &probe.Probe{ID: 2})
+
+	// older than all held results
+	m.Add(probeResult(t, 3, 50), &probe.Probe{ID: 3})
+	if _, found := m.LatestTimestamp(3); found {
+		t.Fatalf("expected result of probe 3 to be dropped")
+	}
+
+	// replaces the oldest result
+	m.Add(probeResult(t, 4, 300), &probe.Probe{ID: 4})
+	if m.ProbeCount() != 2 {
+		t.Fatalf("expected 2 probes, got %d", m.ProbeCount())
+	}
+
+	if _, found := m.LatestTimestamp(1); found {
+		t.Fatalf("expected result of probe 1 to be removed")
+	}
+}
+
+func probeResult(t *testing.T, probeID, ts int) *mdms.Result {
+	t.Helper()
+
+	res := &mdms.Result{}
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`{"msm_id":1003,"prb_id":%d,"af":4,"type":"ping","timestamp":%d}`, probeID, ts)), res); err != nil {
+		t.Fatalf("could not parse result: %v", err)
+	}
+
+	return res
+}
+
+// countingExporter counts the results exported
+type countingExporter struct {
+	exported *int
+}
+
+func (e countingExporter) Export(*mdms.Result, *probe.Probe, chan<- prometheus.Metric) { *e.exported++ }
+func (e countingExporter) Describe(chan<- *prometheus.Desc)                            {}
+
+func TestMeasurementMaxResultAge(t *testing.T) {
+	exported := 0
+	h := &countingHistogram{Histogram: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_rtt_hist"})}
+	m := NewMeasurement(countingExporter{exported: &exported}, WithHistograms(h), WithMaxResultAge(time.Hour))
+	now := int(time.Now().Unix())
+
+	// e.g. replayed or backfilled results
+	m.Add(probeResult(t, 5, now-7200), &probe.Probe{ID: 5})
+	m.Add(probeResult(t, 6, now), &probe.Probe{ID: 6})
+
+	if h.results != 2 {
+		t.Fatalf("expected results older than max. result age to be observed, got %d", h.results)
+	}
+
+	testutil.CollectAndCount(m)
+	if exported != 1 {
+		t.Fatalf("expected only the recent result to be exported, got %d", exported)
+	}
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package exporter
+
+import (
+	"strconv"
+
+	"github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ResultsReceivedCounter counts results passed to measurements by measurement and type
+	ResultsReceivedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_results_received_total",
+			Help: "Number of results received by measurement and type",
+		},
+		[]string{"measurement_id", "type"},
+	)
+
+	// ResultsAcceptedCounter counts results held by measurements by measurement and type
+	ResultsAcceptedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_results_accepted_total",
+			Help: "Number of results accepted by measurement and type",
+		},
+		[]string{"measurement_id", "type"},
+	)
+
+	// ResultsDroppedCounter counts results not added to a measurement by measurement, type and reason
+	ResultsDroppedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_results_dropped_total",
+			Help: "Number of results dropped by measurement, type and reason (invalid, duplicate, out_of_order, max_probes, parse_error, unregistered)",
+		},
+		[]string{"measurement_id", "type", "reason"},
+	)
+
+	// ResultsEvictedCounter counts results removed from a measurement by measurement, type and reason
+	ResultsEvictedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_results_evicted_total",
+			Help: "Number of results removed by measurement, type and reason (retention, max_probes)",
+		},
+		[]string{"measurement_id", "type", "reason"},
+	)
+
+	// SeriesDroppedCounter counts series not exported as a series budget was exceeded by measurement and budget
+	SeriesDroppedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "atlas_exporter_series_dropped_total",
+			Help: "Number of series dropped on scrapes as a series budget was exceeded by measurement and budget (measurement, total)",
+		},
+		[]string{"measurement_id", "budget"},
+	)
+)
+
+// ResultReceived counts a result received
+func ResultReceived(m *measurement.Result) {
+	ResultsReceivedCounter.WithLabelValues(strconv.Itoa(m.MsmId()), m.Type()).Inc()
+}
+
+// ResultDropped counts a result dropped for the reason
+func ResultDropped(m *measurement.Result, reason string) {
+	ResultsDroppedCounter.WithLabelValues(strconv.Itoa(m.MsmId()), m.Type(), reason).Inc()
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package exporter
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/probe"
+)
+
+// ProbeLabels are the labels of result metrics derived from the probe
+type ProbeLabels struct {
+	names []string
+	attrs []string
+}
+
+// NewProbeLabels returns the probe labels selected by the label policy
+func NewProbeLabels(p config.LabelPolicy) *ProbeLabels {
+	l := &ProbeLabels{}
+
+	for _, a := range config.DefaultProbeLabels {
+		if !slices.Contains(p.Drop, a) {
+			l.add(a, a)
+		}
+	}
+
+	for _, a := range p.Add {
+		l.add(config.ProbeLabelName(a), a)
+	}
+
+	return l
+}
+
+// add adds the label unless a label of the same name was added before (e.g. tags only differing in
+// characters invalid in label names), since metrics must not have duplicate label names
+func (l *ProbeLabels) add(name, attr string) {
+	if slices.Contains(l.names, name) {
+		return
+	}
+
+	l.names = append(l.names, name)
+	l.attrs = append(l.attrs, attr)
+}
+
+// Names returns the names of the labels
+func (l *ProbeLabels) Names() []string {
+	return l.names
+}
+
+// Values returns the label values for a probe. The IP version af selects ASN and prefix.
+func (l *ProbeLabels) Values(p *probe.Probe, af int) []string {
+	values := make([]string, len(l.attrs))
+	for i, a := range l.attrs {
+		values[i] = probeAttribute(p, a, af)
+	}
+
+	return values
+}
+
+func probeAttribute(p *probe.Probe, attr string, af int) string {
+	switch attr {
+	case "asn":
+		return strconv.Itoa(p.ASNForIPVersion(af))
+	case "country_code":
+		return p.CountryCode
+	case "lat":
+		return p.Latitude()
+	case "long":
+		return p.Longitude()
+	case "is_anchor":
+		return strconv.FormatBool(p.IsAnchor)
+	case "is_public":
+		return strconv.FormatBool(p.IsPublic)
+	case "prefix":
+		return p.PrefixForIPVersion(af)
+	case "firmware_version":
+		return strconv.Itoa(p.FirmwareVersion)
+	case "status":
+		return p.Status.Name
+	}
+
+	if tag, found := strings.CutPrefix(attr, "tag:"); found {
+		return strconv.FormatBool(p.HasTag(tag))
+	}
+
+	return ""
+}
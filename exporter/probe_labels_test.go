@@ -0,0 +1,50 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/probe"
+)
+
+func TestProbeLabels(t *testing.T) {
+	p := &probe.Probe{ID: 1, Asn4: 3320, Asn6: 3320, CountryCode: "DE", IsAnchor: true, PrefixV4: "192.0.2.0/24", PrefixV6: "2001:db8::/32"}
+	p.Tags = []probe.Tag{{Slug: "system-ipv6-works"}}
+
+	l := NewProbeLabels(config.LabelPolicy{})
+	if !reflect.DeepEqual(l.Names(), config.DefaultProbeLabels) {
+		t.Fatalf("expected default labels, got %v", l.Names())
+	}
+
+	l = NewProbeLabels(config.LabelPolicy{
+		Drop: []string{"lat", "long"},
+		Add:  []string{"is_anchor", "prefix", "tag:system-ipv6-works", "tag:system-anchor"},
+	})
+
+	expected := []string{"asn", "country_code", "is_anchor", "prefix", "tag_system_ipv6_works", "tag_system_anchor"}
+	if !reflect.DeepEqual(l.Names(), expected) {
+		t.Fatalf("expected labels %v, got %v", expected, l.Names())
+	}
+
+	values := []string{"3320", "DE", "true", "2001:db8::/32", "true", "false"}
+	if v := l.Values(p, 6); !reflect.DeepEqual(v, values) {
+		t.Fatalf("expected values %v, got %v", values, v)
+	}
+}
+
+func TestProbeLabels_SameLabelName(t *testing.T) {
+	p := &probe.Probe{ID: 1}
+	p.Tags = []probe.Tag{{Slug: "a-b"}}
+
+	l := NewProbeLabels(config.LabelPolicy{Add: []string{"tag:a-b", "tag:a_b", "tag:a-b"}})
+
+	expected := []string{"asn", "country_code", "lat", "long", "tag_a_b"}
+	if !reflect.DeepEqual(l.Names(), expected) {
+		t.Fatalf("expected labels %v, got %v", expected, l.Names())
+	}
+
+	if v := l.Values(p, 4); len(v) != len(expected) || v[4] != "true" {
+		t.Fatalf("expected a value per label with the first tag, got %v", v)
+	}
+}
@@ -11,8 +11,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/czerwonk/atlas_exporter/admin"
 	"github.com/czerwonk/atlas_exporter/atlas"
 	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/discovery"
+	"github.com/czerwonk/atlas_exporter/exporter"
+	"github.com/czerwonk/atlas_exporter/metadata"
+	"github.com/czerwonk/atlas_exporter/probe"
+	"github.com/czerwonk/atlas_exporter/record"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -28,6 +34,7 @@ var (
 	showVersion = pflag.Bool("version", false, "Print version information.")
 	cfg         *config.Config
 	strategy    atlas.Strategy
+	registry    *atlas.Registry
 )
 
 func init() {}
@@ -61,12 +68,79 @@ func main() {
 	rootCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	if cfg.Streaming.Enabled {
-		strategy = atlas.NewStreamingStrategy(rootCtx, cfg, cfg.Streaming.BufferSize)
-	} else {
-		strategy = atlas.NewRequestStrategy(cfg, cfg.Worker.Count)
+	if err := atlas.InitClient(cfg); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	log.Infof("Using Atlas API at %s and Streaming API at %s", cfg.Atlas.APIURL, cfg.Atlas.StreamURL)
+
+	// Probe cache has to be ready before any strategy starts processing results
+	log.Infof("Cache TTL: %v", cfg.Cache.TTL)
+	log.Infof("Cache cleanup interval: %v", cfg.Cache.Cleanup)
+	cacheOpts := []atlas.CacheOpt{
+		atlas.WithProbeCacheOpts(
+			probe.WithStaleTTL(cfg.Cache.StaleTTL),
+			probe.WithNegativeTTL(cfg.Cache.NegativeTTL),
+			probe.WithMaxSize(int(cfg.Cache.MaxSize)),
+		),
+		atlas.WithMetadataCacheOpts(metadata.WithNegativeTTL(cfg.Cache.NegativeTTL)),
+	}
+	if cfg.Cache.File != "" {
+		cacheOpts = append(cacheOpts, atlas.WithCacheFile(cfg.Cache.File, cfg.Cache.SaveInterval))
+	}
+	atlas.InitCache(rootCtx, cfg.Cache.TTL, cfg.Cache.Cleanup, cacheOpts...)
+	defer atlas.SaveCache()
+
+	registry = atlas.NewRegistry(cfg)
+	if len(cfg.Discovery.Rules) > 0 && !cfg.Replay.Enabled {
+		// fail fast on invalid rules, on reload they are only logged
+		if _, err := discovery.New(atlas.APIClient(), cfg); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	}
+	startDiscovery(rootCtx, cfg)
+
+	switch {
+	case cfg.Replay.Enabled:
+		strategy, err = atlas.NewReplayStrategy(rootCtx, cfg)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	case cfg.Streaming.Enabled:
+		opts := []atlas.StreamingStrategyOpt{atlas.WithRegistry(registry)}
+		if cfg.Record.Enabled {
+			rec, err := record.NewRecorder(cfg)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			defer func() {
+				if err := rec.Close(); err != nil {
+					log.Errorf("could not close recorder: %v", err)
+				}
+			}()
+
+			log.Infof("Recording streamed results to %s", cfg.Record.Path)
+			opts = append(opts, atlas.WithRecorder(rec))
+		}
+		strategy = atlas.NewStreamingStrategy(rootCtx, cfg, cfg.Streaming.BufferSize, opts...)
+	default:
+		strategy = atlas.NewRequestStrategy(cfg, cfg.Worker.Count, atlas.WithRequestRegistry(registry))
+	}
+
+	if len(cfg.Discovery.Rules) > 0 && cfg.Replay.Enabled {
+		log.Warn("Discovery is not supported in replay mode, discovery rules are ignored")
+	}
+
+	if cfg.Record.Enabled && (cfg.Replay.Enabled || !cfg.Streaming.Enabled) {
+		log.Warn("Recording is only supported in streaming mode, record.enabled is ignored")
 	}
 
+	atlas.ConfigLastReloadSuccessfulGauge.Set(1)
+	handleReloads(rootCtx, pflag.CommandLine)
+
 	if !cfg.Profiling.Enabled {
 		http.DefaultServeMux = http.NewServeMux()
 	}
@@ -85,24 +159,21 @@ func printVersion() {
 // legacy loadConfig removed; using koanf loader in main
 
 func startServer(ctx context.Context) {
+	cfg := currentConfig()
+
 	log.Infof("Starting atlas exporter (Version: %s)", version)
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, _ = w.Write([]byte(`<html>
-            <head><title>RIPE Atlas Exporter (Version ` + version + `)</title></head>
-            <body>
-            <h1>RIPE Atlas Exporter</h1>
-            <h2>Example</h2>
-            <p>Metrics for measurement configured in configuration file:</p>
-            <p><a href="` + cfg.Web.TelemetryPath + `">` + r.Host + cfg.Web.TelemetryPath + `</a></p>
-            <p>Metrics for measurement with id 8809582:</p>
-            <p><a href="` + cfg.Web.TelemetryPath + `?measurement_id=8809582">` + r.Host + cfg.Web.TelemetryPath + `?measurement_id=8809582</a></p>
-            <h2>More information</h2>
-            <p><a href="https://github.com/rjocoleman/atlas_exporter">github.com/rjocoleman/atlas_exporter</a></p>
-            </body>
-            </html>`))
-	})
+	http.HandleFunc("/", handleIndexRequest)
+	http.HandleFunc("/status", handleStatusRequest)
 	http.HandleFunc(cfg.Web.TelemetryPath, errorHandler(handleMetricsRequest))
 
+	if cfg.Admin.Enabled {
+		api := admin.NewAPI(registry, currentStrategy, func() config.Secret {
+			return currentConfig().Admin.Token
+		})
+		api.Register(http.DefaultServeMux)
+		log.Infof("Admin API enabled at %s", admin.Prefix)
+	}
+
 	// Health check endpoints
 	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -110,7 +181,7 @@ func startServer(ctx context.Context) {
 	})
 
 	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		if strategy != nil && strategy.IsHealthy() {
+		if s := currentStrategy(); s != nil && s.IsHealthy() {
 			w.WriteHeader(http.StatusOK)
 			_, _ = w.Write([]byte("ready\n"))
 		} else {
@@ -119,10 +190,6 @@ func startServer(ctx context.Context) {
 		}
 	})
 
-	log.Infof("Cache TTL: %v", cfg.Cache.TTL)
-	log.Infof("Cache cleanup interval: %v", cfg.Cache.Cleanup)
-	atlas.InitCache(ctx, cfg.Cache.TTL, cfg.Cache.Cleanup)
-
 	srv := &http.Server{
 		Addr:              cfg.Web.ListenAddress,
 		ReadTimeout:       10 * time.Second,
@@ -173,15 +240,16 @@ func handleMetricsRequest(w http.ResponseWriter, r *http.Request) error {
 	id := r.URL.Query().Get("measurement_id")
 	log.Debugf("handleMetricsRequest called with measurement_id=%s", id)
 
-	s := strategy
+	cfg := currentConfig()
+	s := currentStrategy()
 
 	ids := []string{}
 	if len(id) > 0 {
 		ids = append(ids, id)
-		s = atlas.NewRequestStrategy(cfg, cfg.Worker.Count)
+		s = atlas.NewRequestStrategy(cfg, cfg.Worker.Count, atlas.WithRequestRegistry(registry))
 		log.Debugf("Using request strategy for specific measurement: %s", id)
 	} else {
-		ids = append(ids, cfg.MeasurementIDs()...)
+		ids = append(ids, registry.IDs()...)
 		log.Debugf("Using streaming strategy for configured measurements: %v", ids)
 	}
 
@@ -220,12 +288,59 @@ func handleMetricsRequest(w http.ResponseWriter, r *http.Request) error {
 	reg.MustRegister(atlas.LastDataTimestampGauge)
 	reg.MustRegister(atlas.BuildInfoGauge)
 	reg.MustRegister(atlas.ScrapeBuildDuration)
+	reg.MustRegister(discovery.DiscoveredGauge)
+	reg.MustRegister(atlas.ConfigReloadsCounter)
+	reg.MustRegister(atlas.ConfigLastReloadSuccessfulGauge)
+	reg.MustRegister(atlas.ProbeRequestsCounter)
+	reg.MustRegister(atlas.DegradedResultsCounter)
+	reg.MustRegister(exporter.ResultsReceivedCounter)
+	reg.MustRegister(exporter.ResultsAcceptedCounter)
+	reg.MustRegister(exporter.ResultsDroppedCounter)
+	reg.MustRegister(exporter.ResultsEvictedCounter)
+	reg.MustRegister(exporter.SeriesDroppedCounter)
+	reg.MustRegister(atlas.ProbeAPIRequestDuration)
+	reg.MustRegister(atlas.ProbeAPIErrorsCounter)
+	reg.MustRegister(atlas.StreamReconnectsCounter)
+	reg.MustRegister(atlas.StreamSubscribeFailuresCounter)
+	for _, c := range atlas.ProbeCacheCollectors() {
+		reg.MustRegister(c)
+	}
+	if q, ok := currentStrategy().(atlas.QueueReporter); ok {
+		reg.MustRegister(atlas.StreamQueueLengthCollector(q))
+	}
+	if sr, ok := s.(atlas.StatusReporter); ok {
+		reg.MustRegister(atlas.HeldResultsCollector(sr, ids))
+	}
 
 	if len(measurements) > 0 {
-		c := newCollector(measurements)
+		c := newCollector(measurements,
+			withSeriesBudget(cfg.Series.MaxPerMeasurement, cfg.Series.MaxTotal, cfg.Series.PriorityProbes))
 		reg.MustRegister(c)
 	}
 
+	if cfg.Metrics.ProbeInfoEnabled {
+		probes := make([]*probe.Probe, 0)
+		for _, m := range measurements {
+			probes = append(probes, m.Probes()...)
+		}
+		reg.MustRegister(probe.NewCollector(probes))
+	}
+
+	if cfg.Metrics.MeasurementInfoEnabled && !cfg.Replay.Enabled {
+		// definitions are only retrieved for registered measurements, not for any ID requested
+		registered := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if _, found := registry.Get(id); found {
+				registered = append(registered, id)
+			}
+		}
+
+		ms := atlas.MeasurementMetadata(ctx, registered, cfg.Worker.Count, func(id string) config.Secret {
+			return registry.APIKeyFor(cfg, id)
+		})
+		reg.MustRegister(metadata.NewCollector(ms))
+	}
+
 	l := log.New()
 	l.Level = log.ErrorLevel
 
@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package metadata
+
+import (
+	"sync"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/api"
+)
+
+// Cache caches measurement definitions. Failed lookups are cached for a negative TTL.
+type Cache struct {
+	cache       map[string]*cacheItem
+	mutex       sync.RWMutex
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+type cacheItem struct {
+	expires time.Time
+	value   *api.Measurement
+}
+
+// CacheOpt are options to apply to the cache
+type CacheOpt func(c *Cache)
+
+// WithNegativeTTL caches failed lookups for d
+func WithNegativeTTL(d time.Duration) CacheOpt {
+	return func(c *Cache) {
+		c.negativeTTL = d
+	}
+}
+
+// NewCache creates a measurement definition cache
+func NewCache(ttl time.Duration, opts ...CacheOpt) *Cache {
+	c := &Cache{ttl: ttl, cache: make(map[string]*cacheItem)}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Get retrieves a measurement definition from the cache (if exists, else returns false)
+func (c *Cache) Get(id string) (*api.Measurement, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if m, found := c.cache[id]; found && m.value != nil && time.Now().Before(m.expires) {
+		return m.value, true
+	}
+
+	return nil, false
+}
+
+// Failed returns true if the lookup of the definition failed within the negative TTL
+func (c *Cache) Failed(id string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	m, found := c.cache[id]
+	return found && m.value == nil && time.Now().Before(m.expires)
+}
+
+// Add adds a measurement definition to the cache
+func (c *Cache) Add(id string, m *api.Measurement) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.cache[id] = &cacheItem{expires: time.Now().Add(c.ttl), value: m}
+}
+
+// AddFailed records a failed lookup (e.g. of an unknown measurement)
+func (c *Cache) AddFailed(id string) {
+	if c.negativeTTL <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.cache[id] = &cacheItem{expires: time.Now().Add(c.negativeTTL)}
+}
+
+// CleanUp removes expired cache items
+func (c *Cache) CleanUp() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expired := 0
+	for k, v := range c.cache {
+		if v.expires.Before(time.Now()) {
+			delete(c.cache, k)
+			expired++
+		}
+	}
+
+	return expired
+}
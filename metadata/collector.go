@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package metadata
+
+import (
+	"strconv"
+
+	"github.com/czerwonk/atlas_exporter/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ns  = "atlas"
+	sub = "measurement"
+)
+
+var (
+	infoDesc         *prometheus.Desc
+	intervalDesc     *prometheus.Desc
+	participantsDesc *prometheus.Desc
+	startTimeDesc    *prometheus.Desc
+	stopTimeDesc     *prometheus.Desc
+)
+
+func init() {
+	labels := []string{"measurement"}
+	infoDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "info"), "Definition of the measurement",
+		[]string{"measurement", "description", "target", "type", "ip_version", "status"}, nil)
+	intervalDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "interval_seconds"), "Interval of the measurement", labels, nil)
+	participantsDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "participants"), "Number of probes participating in the measurement", labels, nil)
+	startTimeDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "start_time_seconds"), "Start time of the measurement since unix epoch", labels, nil)
+	stopTimeDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "stop_time_seconds"), "Stop time of the measurement since unix epoch", labels, nil)
+}
+
+// Collector exports the definitions of measurements
+type Collector struct {
+	measurements []*api.Measurement
+}
+
+// NewCollector returns a collector exporting the definitions of the measurements
+func NewCollector(measurements []*api.Measurement) *Collector {
+	return &Collector{measurements: measurements}
+}
+
+// Describe implements Prometheus Collector interface
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- infoDesc
+	ch <- intervalDesc
+	ch <- participantsDesc
+	ch <- startTimeDesc
+	ch <- stopTimeDesc
+}
+
+// Collect implements Prometheus Collector interface
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.measurements {
+		id := strconv.Itoa(m.ID)
+
+		ch <- prometheus.MustNewConstMetric(infoDesc, prometheus.GaugeValue, 1,
+			id, m.Description, m.Target, m.Type, strconv.Itoa(m.AF), m.Status.Name)
+
+		if m.Interval > 0 {
+			ch <- prometheus.MustNewConstMetric(intervalDesc, prometheus.GaugeValue, float64(m.Interval), id)
+		}
+
+		if m.ParticipantCount != nil {
+			ch <- prometheus.MustNewConstMetric(participantsDesc, prometheus.GaugeValue, float64(*m.ParticipantCount), id)
+		}
+
+		if m.StartTime > 0 {
+			ch <- prometheus.MustNewConstMetric(startTimeDesc, prometheus.GaugeValue, float64(m.StartTime), id)
+		}
+
+		if m.StopTime > 0 {
+			ch <- prometheus.MustNewConstMetric(stopTimeDesc, prometheus.GaugeValue, float64(m.StopTime), id)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package metadata
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	participants := 42
+	m := &api.Measurement{
+		ID:               1001,
+		Type:             "ping",
+		Target:           "k.root-servers.net",
+		Description:      "k-root",
+		AF:               6,
+		Interval:         240,
+		StartTime:        1000,
+		ParticipantCount: &participants,
+	}
+	m.Status.Name = "Ongoing"
+
+	expected := `
+# HELP atlas_measurement_info Definition of the measurement
+# TYPE atlas_measurement_info gauge
+atlas_measurement_info{description="k-root",ip_version="6",measurement="1001",status="Ongoing",target="k.root-servers.net",type="ping"} 1
+# HELP atlas_measurement_interval_seconds Interval of the measurement
+# TYPE atlas_measurement_interval_seconds gauge
+atlas_measurement_interval_seconds{measurement="1001"} 240
+# HELP atlas_measurement_participants Number of probes participating in the measurement
+# TYPE atlas_measurement_participants gauge
+atlas_measurement_participants{measurement="1001"} 42
+# HELP atlas_measurement_start_time_seconds Start time of the measurement since unix epoch
+# TYPE atlas_measurement_start_time_seconds gauge
+atlas_measurement_start_time_seconds{measurement="1001"} 1000
+`
+	require.NoError(t, testutil.CollectAndCompare(NewCollector([]*api.Measurement{m}), strings.NewReader(expected)))
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(0)
+	c.Add("1001", &api.Measurement{ID: 1001})
+
+	_, found := c.Get("1001")
+	require.False(t, found)
+	require.Equal(t, 1, c.CleanUp())
+}
+
+func TestCacheFailed(t *testing.T) {
+	c := NewCache(time.Hour)
+	c.AddFailed("1001")
+	require.False(t, c.Failed("1001"), "failed lookups are not cached without negative TTL")
+
+	c = NewCache(time.Hour, WithNegativeTTL(time.Hour))
+	c.AddFailed("1001")
+	require.True(t, c.Failed("1001"))
+
+	_, found := c.Get("1001")
+	require.False(t, found)
+
+	c.Add("1001", &api.Measurement{ID: 1001})
+	require.False(t, c.Failed("1001"))
+}
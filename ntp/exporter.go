@@ -6,31 +6,33 @@ import (
 	"strconv"
 
 	"github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/czerwonk/atlas_exporter/exporter"
 	"github.com/czerwonk/atlas_exporter/probe"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-var (
-	labels             []string
+type ntpExporter struct {
+	id                 string
+	probeLabels        *exporter.ProbeLabels
 	pollDesc           *prometheus.Desc
 	precisionDesc      *prometheus.Desc
 	roolDelayDesc      *prometheus.Desc
 	rootDispersionDesc *prometheus.Desc
 	ntpVersionDesc     *prometheus.Desc
-)
-
-func init() {
-	labels = []string{"measurement", "probe", "dst_addr", "dst_name", "asn", "ip_version", "country_code", "lat", "long"}
-
-	pollDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "poll"), "Poll", labels, nil)
-	precisionDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "precision"), "Precision", labels, nil)
-	roolDelayDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "root_delay"), "Root delay", labels, nil)
-	rootDispersionDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "root_dispersion"), "Root dispersion", labels, nil)
-	ntpVersionDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "ntp_version"), "NTP Version", labels, nil)
 }
 
-type ntpExporter struct {
-	id string
+func newNTPExporter(id string, probeLabels *exporter.ProbeLabels) *ntpExporter {
+	labels := append([]string{"measurement", "probe", "dst_addr", "dst_name", "ip_version"}, probeLabels.Names()...)
+
+	return &ntpExporter{
+		id:                 id,
+		probeLabels:        probeLabels,
+		pollDesc:           prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "poll"), "Poll", labels, nil),
+		precisionDesc:      prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "precision"), "Precision", labels, nil),
+		roolDelayDesc:      prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "root_delay"), "Root delay", labels, nil),
+		rootDispersionDesc: prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "root_dispersion"), "Root dispersion", labels, nil),
+		ntpVersionDesc:     prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "ntp_version"), "NTP Version", labels, nil),
+	}
 }
 
 // Export exports a prometheus metric
@@ -40,25 +42,22 @@ func (m *ntpExporter) Export(res *measurement.Result, probe *probe.Probe, ch cha
 		strconv.Itoa(probe.ID),
 		res.DstAddr(),
 		res.DstName(),
-		strconv.Itoa(probe.ASNForIPVersion(res.Af())),
 		strconv.Itoa(res.Af()),
-		probe.CountryCode,
-		probe.Latitude(),
-		probe.Longitude(),
 	}
+	labelValues = append(labelValues, m.probeLabels.Values(probe, res.Af())...)
 
-	ch <- prometheus.MustNewConstMetric(pollDesc, prometheus.GaugeValue, res.Poll(), labelValues...)
-	ch <- prometheus.MustNewConstMetric(precisionDesc, prometheus.GaugeValue, res.Precision(), labelValues...)
-	ch <- prometheus.MustNewConstMetric(roolDelayDesc, prometheus.GaugeValue, res.RootDelay(), labelValues...)
-	ch <- prometheus.MustNewConstMetric(rootDispersionDesc, prometheus.GaugeValue, res.RootDispersion(), labelValues...)
-	ch <- prometheus.MustNewConstMetric(ntpVersionDesc, prometheus.GaugeValue, float64(res.Version()), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.pollDesc, prometheus.GaugeValue, res.Poll(), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.precisionDesc, prometheus.GaugeValue, res.Precision(), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.roolDelayDesc, prometheus.GaugeValue, res.RootDelay(), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.rootDispersionDesc, prometheus.GaugeValue, res.RootDispersion(), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.ntpVersionDesc, prometheus.GaugeValue, float64(res.Version()), labelValues...)
 }
 
 // Describe exports metric descriptions for Prometheus
 func (m *ntpExporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- pollDesc
-	ch <- precisionDesc
-	ch <- roolDelayDesc
-	ch <- rootDispersionDesc
-	ch <- ntpVersionDesc
+	ch <- m.pollDesc
+	ch <- m.precisionDesc
+	ch <- m.roolDelayDesc
+	ch <- m.rootDispersionDesc
+	ch <- m.ntpVersionDesc
 }
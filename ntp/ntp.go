@@ -13,16 +13,28 @@ const (
 )
 
 // NewMeasurement returns a new instance of `exorter.Measurement` for a NTP measurement
-func NewMeasurement(id string, cfg *config.Config) *exporter.Measurement {
+func NewMeasurement(id string, s config.MeasurementSettings) *exporter.Measurement {
 	opts := []exporter.MeasurementOpt{}
 
-	if cfg.FilterInvalidResults {
+	if s.FilterInvalidResults {
 		opts = append(opts, exporter.WithValidator(&exporter.DefaultResultValidator{}))
 	}
 
-	if cfg.MaxResultAge > 0 {
-		opts = append(opts, exporter.WithMaxResultAge(cfg.MaxResultAge))
+	if s.MaxResultAge > 0 {
+		opts = append(opts, exporter.WithMaxResultAge(s.MaxResultAge))
 	}
 
-	return exporter.NewMeasurement(&ntpExporter{id}, opts...)
+	if len(s.Labels) > 0 {
+		opts = append(opts, exporter.WithLabels(s.Labels))
+	}
+
+	if s.Retention > 0 {
+		opts = append(opts, exporter.WithRetention(s.Retention))
+	}
+
+	if s.MaxProbes > 0 {
+		opts = append(opts, exporter.WithMaxProbes(s.MaxProbes))
+	}
+
+	return exporter.NewMeasurement(newNTPExporter(id, exporter.NewProbeLabels(s.LabelPolicy("ntp"))), opts...)
 }
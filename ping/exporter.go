@@ -6,12 +6,14 @@ import (
 	"strconv"
 
 	"github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/czerwonk/atlas_exporter/exporter"
 	"github.com/czerwonk/atlas_exporter/probe"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-var (
-	labels         []string
+type pingExporter struct {
+	id             string
+	probeLabels    *exporter.ProbeLabels
 	successDesc    *prometheus.Desc
 	minLatencyDesc *prometheus.Desc
 	maxLatencyDesc *prometheus.Desc
@@ -21,23 +23,36 @@ var (
 	dupDesc        *prometheus.Desc
 	ttlDesc        *prometheus.Desc
 	sizeDesc       *prometheus.Desc
-)
-
-type pingExporter struct {
-	id string
+	lossDesc       *prometheus.Desc
+	medianDesc     *prometheus.Desc
+	stdDevDesc     *prometheus.Desc
+	jitterDesc     *prometheus.Desc
+	timeoutsDesc   *prometheus.Desc
+	errorsDesc     *prometheus.Desc
 }
 
-func init() {
-	labels = []string{"measurement", "probe", "dst_addr", "dst_name", "asn", "ip_version", "country_code", "lat", "long"}
-	successDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "success"), "Destination was reachable", labels, nil)
-	minLatencyDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "min_latency"), "Minimum latency", labels, nil)
-	maxLatencyDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "max_latency"), "Maximum latency", labels, nil)
-	avgLatencyDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "avg_latency"), "Average latency", labels, nil)
-	sentDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "sent"), "Number of sent icmp requests", labels, nil)
-	rcvdDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "received"), "Number of received icmp repsponses", labels, nil)
-	dupDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "dup"), "Number of duplicate icmp repsponses", labels, nil)
-	ttlDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "ttl"), "Time-to-live field in the response", labels, nil)
-	sizeDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "size"), "Size of ICMP packet", labels, nil)
+func newPingExporter(id string, probeLabels *exporter.ProbeLabels) *pingExporter {
+	labels := append([]string{"measurement", "probe", "dst_addr", "dst_name", "ip_version"}, probeLabels.Names()...)
+
+	return &pingExporter{
+		id:             id,
+		probeLabels:    probeLabels,
+		successDesc:    prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "success"), "Destination was reachable", labels, nil),
+		minLatencyDesc: prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "min_latency"), "Minimum latency", labels, nil),
+		maxLatencyDesc: prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "max_latency"), "Maximum latency", labels, nil),
+		avgLatencyDesc: prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "avg_latency"), "Average latency", labels, nil),
+		sentDesc:       prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "sent"), "Number of sent icmp requests", labels, nil),
+		rcvdDesc:       prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "received"), "Number of received icmp repsponses", labels, nil),
+		dupDesc:        prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "dup"), "Number of duplicate icmp repsponses", labels, nil),
+		ttlDesc:        prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "ttl"), "Time-to-live field in the response", labels, nil),
+		sizeDesc:       prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "size"), "Size of ICMP packet", labels, nil),
+		lossDesc:       prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "loss_ratio"), "Ratio of icmp requests not answered", labels, nil),
+		medianDesc:     prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "median_latency"), "Median latency", labels, nil),
+		stdDevDesc:     prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "latency_stddev"), "Standard deviation of latency", labels, nil),
+		jitterDesc:     prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "jitter"), "Mean absolute difference of successive latencies", labels, nil),
+		timeoutsDesc:   prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "timeouts"), "Number of icmp requests timed out", labels, nil),
+		errorsDesc:     prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "errors"), "Number of icmp requests failed by error", append(labels, "error"), nil),
+	}
 }
 
 // Export exports a prometheus metric
@@ -47,38 +62,65 @@ func (m *pingExporter) Export(res *measurement.Result, probe *probe.Probe, ch ch
 		strconv.Itoa(probe.ID),
 		res.DstAddr(),
 		res.DstName(),
-		strconv.Itoa(probe.ASNForIPVersion(res.Af())),
 		strconv.Itoa(res.Af()),
-		probe.CountryCode,
-		probe.Latitude(),
-		probe.Longitude(),
 	}
+	labelValues = append(labelValues, m.probeLabels.Values(probe, res.Af())...)
 
 	if res.Min() > 0 {
-		ch <- prometheus.MustNewConstMetric(successDesc, prometheus.GaugeValue, 1, labelValues...)
-		ch <- prometheus.MustNewConstMetric(minLatencyDesc, prometheus.GaugeValue, res.Min(), labelValues...)
-		ch <- prometheus.MustNewConstMetric(maxLatencyDesc, prometheus.GaugeValue, res.Max(), labelValues...)
-		ch <- prometheus.MustNewConstMetric(avgLatencyDesc, prometheus.GaugeValue, res.Avg(), labelValues...)
+		ch <- prometheus.MustNewConstMetric(m.successDesc, prometheus.GaugeValue, 1, labelValues...)
+		ch <- prometheus.MustNewConstMetric(m.minLatencyDesc, prometheus.GaugeValue, res.Min(), labelValues...)
+		ch <- prometheus.MustNewConstMetric(m.maxLatencyDesc, prometheus.GaugeValue, res.Max(), labelValues...)
+		ch <- prometheus.MustNewConstMetric(m.avgLatencyDesc, prometheus.GaugeValue, res.Avg(), labelValues...)
 	} else {
-		ch <- prometheus.MustNewConstMetric(successDesc, prometheus.GaugeValue, 0, labelValues...)
+		ch <- prometheus.MustNewConstMetric(m.successDesc, prometheus.GaugeValue, 0, labelValues...)
 	}
 
-	ch <- prometheus.MustNewConstMetric(sentDesc, prometheus.GaugeValue, float64(res.Sent()), labelValues...)
-	ch <- prometheus.MustNewConstMetric(rcvdDesc, prometheus.GaugeValue, float64(res.Rcvd()), labelValues...)
-	ch <- prometheus.MustNewConstMetric(dupDesc, prometheus.GaugeValue, float64(res.Dup()), labelValues...)
-	ch <- prometheus.MustNewConstMetric(ttlDesc, prometheus.GaugeValue, float64(res.Ttl()), labelValues...)
-	ch <- prometheus.MustNewConstMetric(sizeDesc, prometheus.GaugeValue, float64(res.Size()), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.sentDesc, prometheus.GaugeValue, float64(res.Sent()), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.rcvdDesc, prometheus.GaugeValue, float64(res.Rcvd()), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.dupDesc, prometheus.GaugeValue, float64(res.Dup()), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.ttlDesc, prometheus.GaugeValue, float64(res.Ttl()), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.sizeDesc, prometheus.GaugeValue, float64(res.Size()), labelValues...)
+
+	m.exportReplyStats(newReplyStats(res.PingResults()), labelValues, ch)
+}
+
+func (m *pingExporter) exportReplyStats(s *replyStats, labelValues []string, ch chan<- prometheus.Metric) {
+	if s.replies == 0 {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(m.lossDesc, prometheus.GaugeValue, s.lossRatio(), labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.timeoutsDesc, prometheus.GaugeValue, float64(s.timeouts), labelValues...)
+
+	for t, n := range s.errors {
+		ch <- prometheus.MustNewConstMetric(m.errorsDesc, prometheus.GaugeValue, float64(n), append(labelValues, t)...)
+	}
+
+	if len(s.rtts) > 0 {
+		ch <- prometheus.MustNewConstMetric(m.medianDesc, prometheus.GaugeValue, s.median(), labelValues...)
+		ch <- prometheus.MustNewConstMetric(m.stdDevDesc, prometheus.GaugeValue, s.stdDev(), labelValues...)
+	}
+
+	if len(s.rtts) > 1 {
+		ch <- prometheus.MustNewConstMetric(m.jitterDesc, prometheus.GaugeValue, s.jitter(), labelValues...)
+	}
 }
 
 // Describe exports metric descriptions for Prometheus
 func (m *pingExporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- successDesc
-	ch <- minLatencyDesc
-	ch <- maxLatencyDesc
-	ch <- avgLatencyDesc
-	ch <- sentDesc
-	ch <- rcvdDesc
-	ch <- dupDesc
-	ch <- ttlDesc
-	ch <- sizeDesc
+	ch <- m.successDesc
+	ch <- m.minLatencyDesc
+	ch <- m.maxLatencyDesc
+	ch <- m.avgLatencyDesc
+	ch <- m.sentDesc
+	ch <- m.rcvdDesc
+	ch <- m.dupDesc
+	ch <- m.ttlDesc
+	ch <- m.sizeDesc
+	ch <- m.lossDesc
+	ch <- m.medianDesc
+	ch <- m.stdDevDesc
+	ch <- m.jitterDesc
+	ch <- m.timeoutsDesc
+	ch <- m.errorsDesc
 }
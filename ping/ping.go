@@ -13,18 +13,30 @@ const (
 )
 
 // NewMeasurement returns a new instance of `exorter.Measurement` for a ping measurement
-func NewMeasurement(id, ipVersion string, cfg *config.Config) *exporter.Measurement {
+func NewMeasurement(id, ipVersion string, s config.MeasurementSettings) *exporter.Measurement {
 	opts := []exporter.MeasurementOpt{
-		exporter.WithHistograms(newRttHistogram(id, ipVersion, cfg.HistogramBuckets.Ping.Rtt)),
+		exporter.WithHistograms(newRttHistogram(id, ipVersion, s.HistogramBuckets.Ping.Rtt)),
 	}
 
-	if cfg.FilterInvalidResults {
+	if s.FilterInvalidResults {
 		opts = append(opts, exporter.WithValidator(&exporter.DefaultResultValidator{}))
 	}
 
-	if cfg.MaxResultAge > 0 {
-		opts = append(opts, exporter.WithMaxResultAge(cfg.MaxResultAge))
+	if s.MaxResultAge > 0 {
+		opts = append(opts, exporter.WithMaxResultAge(s.MaxResultAge))
 	}
 
-	return exporter.NewMeasurement(&pingExporter{id}, opts...)
+	if len(s.Labels) > 0 {
+		opts = append(opts, exporter.WithLabels(s.Labels))
+	}
+
+	if s.Retention > 0 {
+		opts = append(opts, exporter.WithRetention(s.Retention))
+	}
+
+	if s.MaxProbes > 0 {
+		opts = append(opts, exporter.WithMaxProbes(s.MaxProbes))
+	}
+
+	return exporter.NewMeasurement(newPingExporter(id, exporter.NewProbeLabels(s.LabelPolicy("ping"))), opts...)
 }
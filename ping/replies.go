@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package ping
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/DNS-OARC/ripeatlas/measurement/ping"
+)
+
+// maxErrorTypeLength limits the length of error types used as label value
+const maxErrorTypeLength = 64
+
+// replyStats are statistics over the individual replies of a ping result
+type replyStats struct {
+	replies  int
+	rtts     []float64
+	timeouts int
+	errors   map[string]int
+}
+
+// newReplyStats walks the replies of a result. Duplicate replies are ignored.
+func newReplyStats(replies []*ping.Result) *replyStats {
+	s := &replyStats{
+		rtts:   make([]float64, 0, len(replies)),
+		errors: make(map[string]int),
+	}
+
+	for _, r := range replies {
+		if r == nil || r.Dup() > 0 {
+			continue
+		}
+
+		switch {
+		case r.Rtt() > 0:
+			s.rtts = append(s.rtts, r.Rtt())
+		case r.Error() != "":
+			s.errors[errorType(r.Error())]++
+		case r.X() == "*":
+			s.timeouts++
+		default:
+			continue
+		}
+
+		s.replies++
+	}
+
+	return s
+}
+
+// lossRatio returns the ratio of requests not answered
+func (s *replyStats) lossRatio() float64 {
+	return float64(s.replies-len(s.rtts)) / float64(s.replies)
+}
+
+// median returns the median RTT
+func (s *replyStats) median() float64 {
+	sorted := append([]float64(nil), s.rtts...)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// stdDev returns the (population) standard deviation of the RTTs
+func (s *replyStats) stdDev() float64 {
+	mean := 0.0
+	for _, rtt := range s.rtts {
+		mean += rtt
+	}
+	mean /= float64(len(s.rtts))
+
+	v := 0.0
+	for _, rtt := range s.rtts {
+		v += (rtt - mean) * (rtt - mean)
+	}
+
+	return math.Sqrt(v / float64(len(s.rtts)))
+}
+
+// jitter returns the mean absolute difference of successive RTTs
+func (s *replyStats) jitter() float64 {
+	d := 0.0
+	for i := 1; i < len(s.rtts); i++ {
+		d += math.Abs(s.rtts[i] - s.rtts[i-1])
+	}
+
+	return d / float64(len(s.rtts)-1)
+}
+
+// errorType returns the type of an error reported by the probe for use as label value,
+// e.g. "sendto failed" for "sendto failed: Network is unreachable"
+func errorType(err string) string {
+	t, _, _ := strings.Cut(err, ":")
+	t = strings.ToLower(strings.TrimSpace(t))
+	if t == "" {
+		return "unknown"
+	}
+
+	if len(t) > maxErrorTypeLength {
+		t = t[:maxErrorTypeLength]
+	}
+
+	return t
+}
@@ -0,0 +1,37 @@
+package ping
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/DNS-OARC/ripeatlas/measurement"
+)
+
+func TestReplyStats(t *testing.T) {
+	res := &measurement.Result{}
+	js := `{"msm_id":1001,"prb_id":5,"af":4,"type":"ping","sent":6,"rcvd":4,"result":[
+		{"rtt":10},{"rtt":14},{"rtt":14,"dup":1},{"x":"*"},{"rtt":12},{"error":"sendto failed: Network is unreachable"},{"rtt":20}]}`
+	if err := json.Unmarshal([]byte(js), res); err != nil {
+		t.Fatalf("could not parse result: %v", err)
+	}
+
+	s := newReplyStats(res.PingResults())
+
+	if s.replies != 6 || s.timeouts != 1 || s.errors["sendto failed"] != 1 {
+		t.Fatalf("unexpected replies %d, timeouts %d, errors %v", s.replies, s.timeouts, s.errors)
+	}
+
+	assertFloat(t, "loss ratio", 2.0/6, s.lossRatio())
+	assertFloat(t, "median", 13, s.median())
+	assertFloat(t, "stddev", math.Sqrt(14), s.stdDev())
+	assertFloat(t, "jitter", (4+2+8)/3.0, s.jitter())
+}
+
+func assertFloat(t *testing.T, name string, expected, got float64) {
+	t.Helper()
+
+	if math.Abs(expected-got) > 1e-9 {
+		t.Fatalf("expected %s %v, got %v", name, expected, got)
+	}
+}
@@ -3,37 +3,159 @@
 package probe
 
 import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
-// Cache caches probe lookup results
+// Cache caches probe lookup results.
+// Expired probes are served for a stale period while they are refreshed, failed lookups are cached for a
+// negative TTL and the least recently used probes are evicted when the max. size is exceeded.
 type Cache struct {
-	cache map[int]*cacheItem
-	mutex sync.RWMutex
-	ttl   time.Duration
+	cache       map[int]*cacheItem
+	lru         *list.List
+	mutex       sync.Mutex
+	ttl         time.Duration
+	staleTTL    time.Duration
+	negativeTTL time.Duration
+	maxSize     int
+	stats       CacheStats
+}
+
+// CacheStats are counters of cache lookups and evictions
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
 }
 
 type cacheItem struct {
-	expires time.Time
-	value   *Probe
+	expires    time.Time
+	value      *Probe
+	refreshing bool
+	retry      time.Time
+	elem       *list.Element
+}
+
+// State is the state of a probe in the cache
+type State int
+
+const (
+	// Missing probes are not cached (or stale for longer than the stale period)
+	Missing State = iota
+	// Fresh probes are cached and not expired
+	Fresh
+	// Stale probes are expired, but served until refreshed
+	Stale
+	// Failed probes could not be retrieved recently
+	Failed
+)
+
+// CacheOpt are options to apply to the cache
+type CacheOpt func(c *Cache)
+
+// WithStaleTTL serves expired probes for d while they are refreshed
+func WithStaleTTL(d time.Duration) CacheOpt {
+	return func(c *Cache) {
+		c.staleTTL = d
+	}
+}
+
+// WithNegativeTTL caches failed lookups for d
+func WithNegativeTTL(d time.Duration) CacheOpt {
+	return func(c *Cache) {
+		c.negativeTTL = d
+	}
+}
+
+// WithMaxSize limits the number of cached probes, evicting the least recently used (0 = unlimited)
+func WithMaxSize(n int) CacheOpt {
+	return func(c *Cache) {
+		c.maxSize = n
+	}
 }
 
 // NewCache creates a probe cache
-func NewCache(ttl time.Duration) *Cache {
-	return &Cache{ttl: ttl, cache: make(map[int]*cacheItem)}
+func NewCache(ttl time.Duration, opts ...CacheOpt) *Cache {
+	c := &Cache{ttl: ttl, cache: make(map[int]*cacheItem), lru: list.New()}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
-// Get retrieves a probe from the cache (if exists, else returns false)
+// Get retrieves a probe from the cache (if exists, else returns false). Stale probes are returned as well.
 func (c *Cache) Get(id int) (*Probe, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	p, s := c.Lookup(id)
+	return p, s == Fresh || s == Stale
+}
+
+// Lookup retrieves a probe and its state from the cache
+func (c *Cache) Lookup(id int) (*Probe, State) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	p, s := c.lookup(id)
+	if s == Fresh || s == Stale {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+
+	return p, s
+}
+
+func (c *Cache) lookup(id int) (*Probe, State) {
+	item, found := c.cache[id]
+	if !found {
+		return nil, Missing
+	}
 
-	if p, found := c.cache[id]; found && time.Now().Before(p.expires) {
-		return p.value, true
+	now := time.Now()
+	if item.value == nil {
+		if now.Before(item.expires) {
+			return nil, Failed
+		}
+		return nil, Missing
+	}
+
+	c.lru.MoveToFront(item.elem)
+
+	if now.Before(item.expires) {
+		return item.value, Fresh
 	}
 
-	return nil, false
+	if now.Before(item.expires.Add(c.staleTTL)) {
+		return item.value, Stale
+	}
+
+	return nil, Missing
+}
+
+// StartRefresh returns true if the probe is stale and neither refreshed already nor failed to refresh recently.
+// The caller has to refresh the probe by Add or AddFailed.
+func (c *Cache) StartRefresh(id int) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	item, found := c.cache[id]
+	if !found || item.value == nil || item.refreshing {
+		return false
+	}
+
+	now := time.Now()
+	if now.Before(item.expires) || now.Before(item.retry) {
+		return false
+	}
+
+	item.refreshing = true
+	return true
 }
 
 // Add adds a probe to the cache
@@ -41,25 +163,176 @@ func (c *Cache) Add(id int, p *Probe) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	c.cache[id] = &cacheItem{expires: time.Now().Add(c.ttl), value: p}
+	c.set(id, &cacheItem{expires: time.Now().Add(c.ttl), value: p})
 }
 
-// CleanUp removes expired cache items
+// AddFailed records a failed lookup. Stale probes are kept and not refreshed again within the negative TTL.
+func (c *Cache) AddFailed(id int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if item, found := c.cache[id]; found && item.value != nil {
+		item.refreshing = false
+		item.retry = now.Add(c.negativeTTL)
+		return
+	}
+
+	if c.negativeTTL <= 0 {
+		return
+	}
+
+	c.set(id, &cacheItem{expires: now.Add(c.negativeTTL)})
+}
+
+// set stores the item and evicts the least recently used items exceeding the max. size. c.mutex has to be held.
+func (c *Cache) set(id int, item *cacheItem) {
+	if old, found := c.cache[id]; found {
+		c.lru.Remove(old.elem)
+	}
+
+	item.elem = c.lru.PushFront(id)
+	c.cache[id] = item
+
+	for c.maxSize > 0 && c.lru.Len() > c.maxSize {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.cache, e.Value.(int))
+		c.stats.Evictions++
+	}
+}
+
+// Stats returns the counters of lookups and evictions
+func (c *Cache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.stats
+}
+
+// Len returns the number of cached items (including failed lookups)
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.cache)
+}
+
+// CleanUp removes items expired (and stale for longer than the stale period)
 func (c *Cache) CleanUp() int {
-	expired := make([]int, 0)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
+	now := time.Now()
+	expired := 0
 	for k, v := range c.cache {
-		if v.expires.Before(time.Now()) {
-			expired = append(expired, k)
+		if c.expired(v, now) {
+			c.lru.Remove(v.elem)
+			delete(c.cache, k)
+			expired++
 		}
 	}
 
+	return expired
+}
+
+func (c *Cache) expired(item *cacheItem, now time.Time) bool {
+	if item.value == nil {
+		return !now.Before(item.expires)
+	}
+
+	return !now.Before(item.expires.Add(c.staleTTL))
+}
+
+type cacheFile struct {
+	Probes []cacheFileItem `json:"probes"`
+}
+
+type cacheFileItem struct {
+	Expires time.Time `json:"expires"`
+	Probe   *Probe    `json:"probe"`
+}
+
+// Save writes all probes not expired (including stale probes) to a file. The file is replaced atomically.
+func (c *Cache) Save(path string) (int, error) {
+	f := cacheFile{Probes: make([]cacheFileItem, 0)}
+
+	c.mutex.Lock()
+	now := time.Now()
+	for e := c.lru.Back(); e != nil; e = e.Prev() {
+		v := c.cache[e.Value.(int)]
+		if v.value != nil && !c.expired(v, now) {
+			f.Probes = append(f.Probes, cacheFileItem{Expires: v.expires, Probe: v.value})
+		}
+	}
+	c.mutex.Unlock()
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	return len(f.Probes), os.Rename(tmp.Name(), path)
+}
+
+// Load adds the probes not expired (including stale probes) from a file written by Save. Items keep their
+// expiry time, limited to the TTL of the cache. A missing file is not an error.
+func (c *Cache) Load(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	f := cacheFile{}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return 0, fmt.Errorf("could not parse cache file %s: %w", path, err)
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	for _, id := range expired {
-		delete(c.cache, id)
+	now := time.Now()
+	loaded := 0
+	for _, item := range f.Probes {
+		if item.Probe == nil {
+			continue
+		}
+
+		expires := item.Expires
+		if limit := now.Add(c.ttl); expires.After(limit) {
+			expires = limit
+		}
+
+		v := &cacheItem{expires: expires, value: item.Probe}
+		if c.expired(v, now) {
+			continue
+		}
+
+		c.set(item.Probe.ID, v)
+		loaded++
 	}
 
-	return len(expired)
+	return min(loaded, c.lru.Len()), nil
 }
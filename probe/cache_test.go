@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "probes.json")
+
+	c := NewCache(time.Hour)
+	c.Add(1, &Probe{ID: 1, Asn4: 3320, CountryCode: "DE"})
+	c.Add(2, &Probe{ID: 2})
+	c.cache[2].expires = time.Now().Add(-time.Second)
+
+	n, err := c.Save(path)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// entries keep their expiry, limited to the TTL of the loading cache
+	loaded := NewCache(time.Minute)
+	n, err = loaded.Load(path)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	p, found := loaded.Get(1)
+	require.True(t, found)
+	require.Equal(t, "DE", p.CountryCode)
+	require.WithinDuration(t, time.Now().Add(time.Minute), loaded.cache[1].expires, time.Second)
+
+	_, found = loaded.Get(2)
+	require.False(t, found)
+
+	n, err = NewCache(time.Hour).Load(filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = NewCache(time.Hour).Load(path)
+	require.Error(t, err)
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	c := NewCache(time.Hour, WithStaleTTL(time.Hour))
+	c.Add(1, &Probe{ID: 1})
+	require.False(t, c.StartRefresh(1))
+
+	c.cache[1].expires = time.Now().Add(-time.Minute)
+	p, state := c.Lookup(1)
+	require.Equal(t, Stale, state)
+	require.Equal(t, 1, p.ID)
+
+	// only one refresh at a time
+	require.True(t, c.StartRefresh(1))
+	require.False(t, c.StartRefresh(1))
+
+	// a failed refresh keeps the stale probe
+	c.AddFailed(1)
+	_, found := c.Get(1)
+	require.True(t, found)
+
+	c.Add(1, &Probe{ID: 1, Asn4: 3320})
+	p, state = c.Lookup(1)
+	require.Equal(t, Fresh, state)
+	require.Equal(t, 3320, p.Asn4)
+
+	c.cache[1].expires = time.Now().Add(-2 * time.Hour)
+	_, state = c.Lookup(1)
+	require.Equal(t, Missing, state)
+	require.Equal(t, 1, c.CleanUp())
+}
+
+func TestCache_NegativeTTL(t *testing.T) {
+	c := NewCache(time.Hour, WithNegativeTTL(time.Minute))
+	c.AddFailed(1)
+
+	p, state := c.Lookup(1)
+	require.Equal(t, Failed, state)
+	require.Nil(t, p)
+
+	c.cache[1].expires = time.Now().Add(-time.Second)
+	_, state = c.Lookup(1)
+	require.Equal(t, Missing, state)
+
+	// failed lookups are not cached without negative TTL
+	c = NewCache(time.Hour)
+	c.AddFailed(1)
+	require.Zero(t, c.Len())
+}
+
+func TestCache_MaxSize(t *testing.T) {
+	c := NewCache(time.Hour, WithMaxSize(2))
+	c.Add(1, &Probe{ID: 1})
+	c.Add(2, &Probe{ID: 2})
+	c.Get(1)
+	c.Add(3, &Probe{ID: 3})
+
+	require.Equal(t, 2, c.Len())
+	_, found := c.Get(2)
+	require.False(t, found, "least recently used probe should be evicted")
+	_, found = c.Get(1)
+	require.True(t, found)
+
+	require.Equal(t, CacheStats{Hits: 2, Misses: 1, Evictions: 1}, c.Stats())
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package probe
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ns  = "atlas"
+	sub = "probe"
+)
+
+var (
+	infoDesc          *prometheus.Desc
+	statusDesc        *prometheus.Desc
+	lastConnectedDesc *prometheus.Desc
+)
+
+func init() {
+	infoDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "info"), "Attributes of the probe",
+		[]string{"probe", "asn_v4", "asn_v6", "country_code", "is_anchor", "is_public", "prefix_v4", "prefix_v6",
+			"address_v4", "address_v6", "firmware_version", "tags"}, nil)
+	statusDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "status"), "Status of the probe (e.g. Connected, Disconnected, Abandoned)",
+		[]string{"probe", "status"}, nil)
+	lastConnectedDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "last_connected_timestamp_seconds"), "Time the probe was connected last since unix epoch",
+		[]string{"probe"}, nil)
+}
+
+// Collector exports the attributes of probes once per probe
+type Collector struct {
+	probes []*Probe
+}
+
+// NewCollector returns a collector exporting the attributes of the probes (duplicates and placeholders are ignored)
+func NewCollector(probes []*Probe) *Collector {
+	seen := make(map[int]bool)
+	unique := make([]*Probe, 0, len(probes))
+	for _, p := range probes {
+		if p == nil || p.Placeholder || seen[p.ID] {
+			continue
+		}
+
+		seen[p.ID] = true
+		unique = append(unique, p)
+	}
+
+	return &Collector{probes: unique}
+}
+
+// Describe implements Prometheus Collector interface
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- infoDesc
+	ch <- statusDesc
+	ch <- lastConnectedDesc
+}
+
+// Collect implements Prometheus Collector interface
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, p := range c.probes {
+		id := strconv.Itoa(p.ID)
+
+		ch <- prometheus.MustNewConstMetric(infoDesc, prometheus.GaugeValue, 1,
+			id,
+			strconv.Itoa(p.Asn4),
+			strconv.Itoa(p.Asn6),
+			p.CountryCode,
+			strconv.FormatBool(p.IsAnchor),
+			strconv.FormatBool(p.IsPublic),
+			p.PrefixV4,
+			p.PrefixV6,
+			p.AddressV4,
+			p.AddressV6,
+			strconv.Itoa(p.FirmwareVersion),
+			p.tagSlugs(),
+		)
+
+		if p.Status.Name != "" {
+			ch <- prometheus.MustNewConstMetric(statusDesc, prometheus.GaugeValue, 1, id, p.Status.Name)
+		}
+
+		if p.LastConnected > 0 {
+			ch <- prometheus.MustNewConstMetric(lastConnectedDesc, prometheus.GaugeValue, float64(p.LastConnected), id)
+		}
+	}
+}
+
+// tagSlugs returns the sorted slugs of the tags of the probe as comma separated list
+func (p *Probe) tagSlugs() string {
+	slugs := make([]string, len(p.Tags))
+	for i, t := range p.Tags {
+		slugs[i] = t.Slug
+	}
+	sort.Strings(slugs)
+
+	return strings.Join(slugs, ",")
+}
@@ -0,0 +1,32 @@
+package probe
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	p, err := FromJSON([]byte(`{"id":6001,"asn_v4":3320,"asn_v6":3320,"country_code":"DE","is_anchor":true,"is_public":true,
+		"prefix_v4":"192.0.2.0/24","address_v4":"192.0.2.1","prefix_v6":null,"address_v6":null,"firmware_version":5080,
+		"last_connected":1700000000,"status":{"id":1,"name":"Connected","since":"2023-11-14T00:00:00Z"},
+		"tags":[{"name":"IPv4 Works","slug":"system-ipv4-works"},{"name":"Anchor","slug":"system-anchor"}]}`))
+	require.NoError(t, err)
+
+	expected := `
+# HELP atlas_probe_info Attributes of the probe
+# TYPE atlas_probe_info gauge
+atlas_probe_info{address_v4="192.0.2.1",address_v6="",asn_v4="3320",asn_v6="3320",country_code="DE",firmware_version="5080",is_anchor="true",is_public="true",prefix_v4="192.0.2.0/24",prefix_v6="",probe="6001",tags="system-anchor,system-ipv4-works"} 1
+# HELP atlas_probe_last_connected_timestamp_seconds Time the probe was connected last since unix epoch
+# TYPE atlas_probe_last_connected_timestamp_seconds gauge
+atlas_probe_last_connected_timestamp_seconds{probe="6001"} 1.7e+09
+# HELP atlas_probe_status Status of the probe (e.g. Connected, Disconnected, Abandoned)
+# TYPE atlas_probe_status gauge
+atlas_probe_status{probe="6001",status="Connected"} 1
+`
+	// probes held by several measurements are exported once
+	c := NewCollector([]*Probe{p, p, nil})
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
@@ -18,6 +18,33 @@ type Probe struct {
 	Geometry    struct {
 		Coordinates []float64 `json:"coordinates"`
 	} `json:"geometry"`
+	Status struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"status"`
+	IsAnchor        bool   `json:"is_anchor"`
+	IsPublic        bool   `json:"is_public"`
+	Tags            []Tag  `json:"tags"`
+	PrefixV4        string `json:"prefix_v4"`
+	PrefixV6        string `json:"prefix_v6"`
+	AddressV4       string `json:"address_v4"`
+	AddressV6       string `json:"address_v6"`
+	FirmwareVersion int    `json:"firmware_version"`
+	LastConnected   int64  `json:"last_connected"`
+
+	// Placeholder is set if the information of the probe could not be retrieved
+	Placeholder bool `json:"-"`
+}
+
+// Tag is a tag assigned to a probe (by the system or the host)
+type Tag struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// NewPlaceholder returns a probe without information, used for results until the probe could be retrieved
+func NewPlaceholder(id int) *Probe {
+	return &Probe{ID: id, Placeholder: true}
 }
 
 // FromJSON parses json and returns a probe
@@ -41,6 +68,26 @@ func (p *Probe) ASNForIPVersion(v int) int {
 	return p.Asn4
 }
 
+// PrefixForIPVersion return the prefix of the probe for the given IP Version
+func (p *Probe) PrefixForIPVersion(v int) string {
+	if v == ipv6 {
+		return p.PrefixV6
+	}
+
+	return p.PrefixV4
+}
+
+// HasTag returns true if the probe is tagged with the tag (by slug)
+func (p *Probe) HasTag(slug string) bool {
+	for _, t := range p.Tags {
+		if t.Slug == slug {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Longitude of the geo location of the probe
 func (p *Probe) Longitude() string {
 	if len(p.Geometry.Coordinates) == 0 {
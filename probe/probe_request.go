@@ -4,29 +4,62 @@ package probe
 
 import (
 	"fmt"
-	"io"
-	"net/http"
-)
+	"net/url"
+	"strconv"
+	"strings"
 
-const url = "https://atlas.ripe.net/api/v2/probes/"
+	"github.com/czerwonk/atlas_exporter/api"
+)
 
 // Get probe information from API
-func Get(id int) (*Probe, error) {
-	c := &http.Client{}
-	u := fmt.Sprintf("%s%d", url, id)
-
-	resp, err := c.Get(u)
+func Get(c *api.Client, id int) (*Probe, error) {
+	body, err := c.Get(fmt.Sprintf("/probes/%d/", id), nil)
+	if err != nil {
+		return nil, err
+	}
 
+	p, err := FromJSON(body)
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() { _ = resp.Body.Close() }()
-	body, err := io.ReadAll(resp.Body)
+	// an unexpected response (e.g. an error object) would otherwise result in a probe without information
+	if p.ID != id {
+		return nil, fmt.Errorf("unexpected response for probe %d", id)
+	}
+
+	return p, nil
+}
+
+// GetMany retrieves information of several probes with a single request (id__in filter).
+// Probes unknown to the API are missing in the result.
+func GetMany(c *api.Client, ids []int) ([]*Probe, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(id)
+	}
+
+	q := url.Values{}
+	q.Set("id__in", strings.Join(s, ","))
+	q.Set("page_size", strconv.Itoa(len(ids)))
 
+	items, err := c.List("/probes/", q)
 	if err != nil {
 		return nil, err
 	}
 
-	return FromJSON(body)
+	res := make([]*Probe, 0, len(items))
+	for _, b := range items {
+		p, err := FromJSON(b)
+		if err != nil {
+			return nil, fmt.Errorf("json.Unmarshal(/probes/): %w", err)
+		}
+		res = append(res, p)
+	}
+
+	return res, nil
 }
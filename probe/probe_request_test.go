@@ -0,0 +1,35 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czerwonk/atlas_exporter/api"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMany(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.Equal(t, "/api/v2/probes/", r.URL.Path)
+		require.Equal(t, "1,2,3", r.URL.Query().Get("id__in"))
+
+		_, _ = w.Write([]byte(`{"next":null,"results":[{"id":1,"asn_v4":3320},{"id":3,"country_code":"NL"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{}
+	cfg.Atlas.APIURL = srv.URL + "/api/v2"
+	c, err := api.NewClient(cfg)
+	require.NoError(t, err)
+
+	probes, err := GetMany(c, []int{1, 2, 3})
+	require.NoError(t, err)
+	require.Len(t, probes, 2)
+	require.Equal(t, 3320, probes[0].Asn4)
+	require.Equal(t, "NL", probes[1].CountryCode)
+	require.Equal(t, 1, requests)
+}
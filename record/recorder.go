@@ -0,0 +1,293 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package record
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const timeFormat = "20060102T150405Z"
+
+// ErrClosed is returned when writing to a closed recorder
+var ErrClosed = errors.New("recorder is closed")
+
+// Recorder archives raw measurement results to per measurement JSONL files,
+// which are rotated periodically and optionally gzip compressed
+type Recorder struct {
+	dir      string
+	rotate   time.Duration
+	compress bool
+	maxAge   time.Duration
+	maxSize  int64
+	now      func() time.Time
+	mu       sync.Mutex
+	files    map[int]*file
+	closed   bool
+	done     chan struct{}
+}
+
+type file struct {
+	name   string
+	period time.Time
+	f      *os.File
+	gz     *gzip.Writer
+}
+
+// NewRecorder returns a recorder writing to the directory configured in cfg.
+// Archives exceeding max age or max size are removed on start and every rotate interval until the recorder is closed.
+func NewRecorder(cfg *config.Config) (*Recorder, error) {
+	if err := os.MkdirAll(cfg.Record.Path, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create record directory: %w", err)
+	}
+
+	r := &Recorder{
+		dir:      cfg.Record.Path,
+		rotate:   cfg.Record.RotateInterval,
+		compress: cfg.Record.Compress,
+		maxAge:   cfg.Record.MaxAge,
+		maxSize:  int64(cfg.Record.MaxSizeMB) * 1024 * 1024,
+		now:      time.Now,
+		files:    make(map[int]*file),
+		done:     make(chan struct{}),
+	}
+
+	if r.maxAge > 0 || r.maxSize > 0 {
+		r.cleanUpAll()
+		go r.cleanUpPeriodically()
+	}
+
+	return r, nil
+}
+
+// Write appends the raw JSON of a result to the current file of the measurement
+func (r *Recorder) Write(msm int, raw []byte) error {
+	line := &bytes.Buffer{}
+	if err := json.Compact(line, raw); err != nil {
+		return fmt.Errorf("invalid result JSON for measurement %d: %w", msm, err)
+	}
+	line.WriteByte('\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+
+	period := r.now().UTC().Truncate(r.rotate)
+
+	f, found := r.files[msm]
+	if found && !f.period.Equal(period) {
+		if err := f.close(); err != nil {
+			log.Errorf("could not close %s: %v", f.name, err)
+		}
+		delete(r.files, msm)
+		found = false
+	}
+
+	if !found {
+		var err error
+		f, err = r.open(msm, period)
+		if err != nil {
+			return err
+		}
+		r.files[msm] = f
+
+		r.cleanUp(msm, f.name)
+	}
+
+	return f.write(line.Bytes())
+}
+
+// Close closes all open files. Writes after closing return ErrClosed.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.closed {
+		close(r.done)
+	}
+	r.closed = true
+
+	var errs []error
+	for msm, f := range r.files {
+		if err := f.close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(r.files, msm)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *Recorder) measurementDir(msm int) string {
+	return filepath.Join(r.dir, strconv.Itoa(msm))
+}
+
+func (r *Recorder) open(msm int, period time.Time) (*file, error) {
+	dir := r.measurementDir(msm)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create record directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%d-%s.jsonl", msm, period.Format(timeFormat))
+	if r.compress {
+		name += ".gz"
+	}
+	name = filepath.Join(dir, name)
+
+	// appending to an existing gzip file adds another gzip member, which readers handle transparently
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", name, err)
+	}
+
+	res := &file{name: name, period: period, f: f}
+	if r.compress {
+		res.gz = gzip.NewWriter(f)
+	}
+
+	log.Debugf("Recording results of measurement %d to %s", msm, name)
+	return res, nil
+}
+
+func (r *Recorder) cleanUpPeriodically() {
+	t := time.NewTicker(r.rotate)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-t.C:
+			r.cleanUpAll()
+		}
+	}
+}
+
+// cleanUpAll applies the retention to all measurement directories,
+// including measurements no longer recorded
+func (r *Recorder) cleanUpAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		log.Errorf("could not list %s: %v", r.dir, err)
+		return
+	}
+
+	for _, e := range entries {
+		msm, err := strconv.Atoi(e.Name())
+		if !e.IsDir() || err != nil {
+			continue
+		}
+
+		current := ""
+		if f, found := r.files[msm]; found {
+			current = f.name
+		}
+		r.cleanUp(msm, current)
+	}
+}
+
+// cleanUp removes files of the measurement exceeding max age or max size (oldest first)
+func (r *Recorder) cleanUp(msm int, current string) {
+	if r.maxAge <= 0 && r.maxSize <= 0 {
+		return
+	}
+
+	dir := r.measurementDir(msm)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Errorf("could not list %s: %v", dir, err)
+		return
+	}
+
+	type archive struct {
+		name string
+		size int64
+		mod  time.Time
+	}
+
+	archives := make([]archive, 0, len(entries))
+	var total int64
+	for _, e := range entries {
+		name := filepath.Join(dir, e.Name())
+		if e.IsDir() || name == current || !strings.Contains(e.Name(), ".jsonl") {
+			continue
+		}
+
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		archives = append(archives, archive{name: name, size: fi.Size(), mod: fi.ModTime()})
+		total += fi.Size()
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].name < archives[j].name
+	})
+
+	cutoff := r.now().Add(-r.maxAge)
+	for _, a := range archives {
+		tooOld := r.maxAge > 0 && a.mod.Before(cutoff)
+		tooBig := r.maxSize > 0 && total > r.maxSize
+		if !tooOld && !tooBig {
+			continue
+		}
+
+		if err := os.Remove(a.name); err != nil {
+			log.Errorf("could not remove %s: %v", a.name, err)
+			continue
+		}
+
+		log.Infof("Removed archived results %s", a.name)
+		total -= a.size
+	}
+}
+
+func (f *file) write(b []byte) error {
+	if f.gz == nil {
+		_, err := f.f.Write(b)
+		return err
+	}
+
+	if _, err := f.gz.Write(b); err != nil {
+		return err
+	}
+
+	// flush every result so the archive is complete up to the last result even after a crash
+	return f.gz.Flush()
+}
+
+func (f *file) close() error {
+	if f.gz != nil {
+		if err := f.gz.Close(); err != nil {
+			_ = f.f.Close()
+			return err
+		}
+	}
+
+	return f.f.Close()
+}
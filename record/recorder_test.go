@@ -0,0 +1,147 @@
+package record
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRecorder(t *testing.T, compress bool) (*Recorder, *time.Time) {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Record.Path = t.TempDir()
+	cfg.Record.RotateInterval = time.Hour
+	cfg.Record.Compress = compress
+
+	r, err := NewRecorder(cfg)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	return r, &now
+}
+
+func readLines(t *testing.T, name string) []string {
+	t.Helper()
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var sc *bufio.Scanner
+	if filepath.Ext(name) == ".gz" {
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		sc = bufio.NewScanner(gz)
+	} else {
+		sc = bufio.NewScanner(f)
+	}
+
+	lines := []string{}
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	require.NoError(t, sc.Err())
+	return lines
+}
+
+func TestRecorderWritesCompactLines(t *testing.T) {
+	r, _ := newTestRecorder(t, false)
+
+	require.NoError(t, r.Write(1001, []byte("{\n  \"msm_id\": 1001,\n  \"prb_id\": 1\n}")))
+	require.NoError(t, r.Write(1001, []byte(`{"msm_id":1001,"prb_id":2}`)))
+	require.Error(t, r.Write(1001, []byte(`not json`)))
+	require.NoError(t, r.Close())
+
+	lines := readLines(t, filepath.Join(r.dir, "1001", "1001-20240501T100000Z.jsonl"))
+	require.Equal(t, []string{`{"msm_id":1001,"prb_id":1}`, `{"msm_id":1001,"prb_id":2}`}, lines)
+
+	require.ErrorIs(t, r.Write(1001, []byte(`{}`)), ErrClosed)
+}
+
+func TestRecorderRotatesCompressedFiles(t *testing.T) {
+	r, now := newTestRecorder(t, true)
+
+	require.NoError(t, r.Write(1001, []byte(`{"prb_id":1}`)))
+	*now = now.Add(time.Hour)
+	require.NoError(t, r.Write(1001, []byte(`{"prb_id":2}`)))
+	require.NoError(t, r.Write(2002, []byte(`{"prb_id":3}`)))
+	require.NoError(t, r.Close())
+
+	require.Equal(t, []string{`{"prb_id":1}`}, readLines(t, filepath.Join(r.dir, "1001", "1001-20240501T100000Z.jsonl.gz")))
+	require.Equal(t, []string{`{"prb_id":2}`}, readLines(t, filepath.Join(r.dir, "1001", "1001-20240501T110000Z.jsonl.gz")))
+	require.Equal(t, []string{`{"prb_id":3}`}, readLines(t, filepath.Join(r.dir, "2002", "2002-20240501T110000Z.jsonl.gz")))
+}
+
+func TestRecorderRetention(t *testing.T) {
+	r, now := newTestRecorder(t, false)
+	r.maxSize = 1
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, r.Write(1001, []byte(`{"prb_id":1}`)))
+		*now = now.Add(time.Hour)
+	}
+	require.NoError(t, r.Close())
+
+	entries, err := os.ReadDir(filepath.Join(r.dir, "1001"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "1001-20240501T120000Z.jsonl", entries[0].Name())
+}
+
+func TestRecorderRetentionOnStart(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Record.Path = t.TempDir()
+	cfg.Record.RotateInterval = time.Hour
+	cfg.Record.MaxAge = time.Hour
+
+	// archives of a measurement no longer recorded
+	dir := filepath.Join(cfg.Record.Path, "1002")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	old := filepath.Join(dir, "1002-20240501T080000Z.jsonl")
+	recent := filepath.Join(dir, "1002-20240501T100000Z.jsonl")
+	for _, name := range []string{old, recent} {
+		require.NoError(t, os.WriteFile(name, []byte("{}\n"), 0o644))
+	}
+	mod := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(old, mod, mod))
+
+	r, err := NewRecorder(cfg)
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.NoFileExists(t, old)
+	require.FileExists(t, recent)
+}
+
+func TestRecorderRetentionOfAllMeasurements(t *testing.T) {
+	r, now := newTestRecorder(t, false)
+	r.maxAge = time.Hour
+
+	require.NoError(t, r.Write(1001, []byte(`{"prb_id":1}`)))
+	current := r.files[1001].name
+
+	// measurement 1002 stopped reporting, so no new file is opened for it
+	dir := filepath.Join(r.dir, "1002")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	old := filepath.Join(dir, "1002-20240501T080000Z.jsonl")
+	require.NoError(t, os.WriteFile(old, []byte("{}\n"), 0o644))
+
+	past := now.Add(-2 * time.Hour)
+	for _, name := range []string{current, old} {
+		require.NoError(t, os.Chtimes(name, past, past))
+	}
+
+	r.cleanUpAll()
+	require.NoError(t, r.Close())
+
+	require.NoFileExists(t, old)
+	require.FileExists(t, current)
+}
@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/czerwonk/atlas_exporter/atlas"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/czerwonk/atlas_exporter/discovery"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+var (
+	stateMu         sync.RWMutex
+	reloadMu        sync.Mutex
+	stopDiscovery   context.CancelFunc
+	discoveryConfig any
+)
+
+func currentConfig() *config.Config {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+
+	return cfg
+}
+
+func currentStrategy() atlas.Strategy {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+
+	return strategy
+}
+
+// handleReloads reloads the configuration on SIGHUP and, if enabled, on changes of the config file
+func handleReloads(ctx context.Context, fs *pflag.FlagSet) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				log.Info("Received SIGHUP, reloading configuration")
+				reload(ctx, fs)
+			}
+		}
+	}()
+
+	path := config.FilePath(fs)
+	if !currentConfig().Reload.Watch || path == "" {
+		return
+	}
+
+	err := config.Watch(ctx, path, func(err error) {
+		if err != nil {
+			log.Errorf("stopped watching config file %s: %v", path, err)
+			return
+		}
+
+		log.Infof("Config file %s changed, reloading configuration", path)
+		reload(ctx, fs)
+	})
+	if err != nil {
+		log.Errorf("could not watch config file %s: %v", path, err)
+		return
+	}
+
+	log.Infof("Watching config file %s for changes", path)
+}
+
+// reload loads and validates the configuration and applies it to the running exporter.
+// On failure the current configuration stays active.
+func reload(ctx context.Context, fs *pflag.FlagSet) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	c, err := config.Load(fs)
+	if err != nil {
+		log.Errorf("could not reload configuration, keeping current configuration: %v", err)
+		atlas.ConfigReloadsCounter.WithLabelValues("failure").Inc()
+		atlas.ConfigLastReloadSuccessfulGauge.Set(0)
+		return
+	}
+
+	old := currentConfig()
+	warnRestartRequired(old, c)
+	setLogLevel(c.Log.Level)
+
+	s := currentStrategy()
+	if r, ok := s.(atlas.Reloader); ok {
+		r.Reload(c)
+	} else if !c.Replay.Enabled && !c.Streaming.Enabled {
+		s = atlas.NewRequestStrategy(c, c.Worker.Count, atlas.WithRequestRegistry(registry))
+	}
+
+	stateMu.Lock()
+	cfg = c
+	strategy = s
+	stateMu.Unlock()
+
+	startDiscovery(ctx, c)
+	registry.Set(atlas.SourceConfig, c.Measurements)
+
+	log.Infof("Configuration reloaded, %d measurements configured", len(registry.IDs()))
+	atlas.ConfigReloadsCounter.WithLabelValues("success").Inc()
+	atlas.ConfigLastReloadSuccessfulGauge.Set(1)
+}
+
+// startDiscovery (re)starts measurement discovery if the discovery settings changed
+func startDiscovery(ctx context.Context, c *config.Config) {
+	if c.Replay.Enabled || reflect.DeepEqual(discoveryConfig, c.Discovery) {
+		return
+	}
+	discoveryConfig = c.Discovery
+
+	if stopDiscovery != nil {
+		stopDiscovery()
+		stopDiscovery = nil
+	}
+
+	if len(c.Discovery.Rules) == 0 {
+		registry.Set("discovery", nil)
+		return
+	}
+
+	d, err := discovery.New(atlas.APIClient(), c)
+	if err != nil {
+		log.Errorf("could not start discovery: %v", err)
+		return
+	}
+
+	log.Infof("Discovering measurements using %d rules every %v", len(c.Discovery.Rules), c.Discovery.Interval)
+
+	dctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	stopDiscovery = func() {
+		// the previous discovery has to clear its gauges before rules are discovered again
+		cancel()
+		<-done
+	}
+	go func() {
+		defer close(done)
+
+		d.Run(dctx, func(ms []config.Measurement) {
+			if dctx.Err() == nil {
+				registry.Set("discovery", ms)
+			}
+		})
+	}()
+}
+
+// warnRestartRequired logs settings which changed but are only applied on start
+func warnRestartRequired(old, c *config.Config) {
+	for _, name := range restartRequired(old, c) {
+		log.Warnf("Changes of %s settings require a restart to take effect", name)
+	}
+}
+
+// restartRequired returns the sorted names of settings which changed but are only applied on start
+func restartRequired(old, c *config.Config) []string {
+	names := make([]string, 0)
+	for name, changed := range map[string]bool{
+		"web":                   old.Web != c.Web,
+		"tls":                   old.TLS != c.TLS,
+		"atlas":                 old.Atlas != c.Atlas,
+		"cache":                 old.Cache != c.Cache,
+		"probes":                old.Probes != c.Probes,
+		"profiling":             old.Profiling != c.Profiling,
+		"replay":                old.Replay != c.Replay,
+		"record":                old.Record != c.Record,
+		"reload":                old.Reload != c.Reload,
+		"admin.enabled":         old.Admin.Enabled != c.Admin.Enabled,
+		"streaming.enabled":     old.Streaming.Enabled != c.Streaming.Enabled,
+		"streaming.buffer_size": old.Streaming.BufferSize != c.Streaming.BufferSize,
+	} {
+		if changed {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/czerwonk/atlas_exporter/atlas"
+	"github.com/czerwonk/atlas_exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/pflag"
+)
+
+// withState sets the state reloads are applied to, restoring the previous state at the end of the test
+func withState(t *testing.T, c *config.Config) {
+	t.Helper()
+
+	prevCfg, prevStrategy, prevRegistry := cfg, strategy, registry
+	prevStop, prevDiscovery := stopDiscovery, discoveryConfig
+	t.Cleanup(func() {
+		if stopDiscovery != nil {
+			stopDiscovery()
+		}
+
+		cfg, strategy, registry = prevCfg, prevStrategy, prevRegistry
+		stopDiscovery, discoveryConfig = prevStop, prevDiscovery
+	})
+
+	cfg = c
+	registry = atlas.NewRegistry(c)
+	strategy = atlas.NewRequestStrategy(c, 1, atlas.WithRequestRegistry(registry))
+	stopDiscovery, discoveryConfig = nil, nil
+}
+
+// configFlags returns flags loading the configuration from a file with the content
+func configFlags(t *testing.T, content string) *pflag.FlagSet {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	config.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--config.file=" + path}); err != nil {
+		t.Fatal(err)
+	}
+
+	return fs
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		success bool
+		ids     []string
+	}{
+		{
+			name:    "measurements are applied",
+			content: "streaming:\n  enabled: false\nmeasurements:\n  - id: 1002\n  - id: 1003\n",
+			success: true,
+			ids:     []string{"1002", "1003"},
+		},
+		{
+			name:    "invalid configuration keeps current configuration",
+			content: "timeout: -1s\nmeasurements:\n  - id: 1002\n",
+			ids:     []string{"1001"},
+		},
+		{
+			name:    "malformed configuration keeps current configuration",
+			content: "measurements: [",
+			ids:     []string{"1001"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			old := &config.Config{Measurements: []config.Measurement{{ID: "1001"}}}
+			withState(t, old)
+			oldStrategy := currentStrategy()
+
+			successes := testutil.ToFloat64(atlas.ConfigReloadsCounter.WithLabelValues("success"))
+			failures := testutil.ToFloat64(atlas.ConfigReloadsCounter.WithLabelValues("failure"))
+
+			reload(context.Background(), configFlags(t, tc.content))
+
+			if ids := registry.IDs(); !slices.Equal(ids, tc.ids) {
+				t.Fatalf("expected measurements %v, got %v", tc.ids, ids)
+			}
+
+			if !tc.success {
+				if currentConfig() != old || currentStrategy() != oldStrategy {
+					t.Fatalf("expected current configuration and strategy to be kept")
+				}
+				if v := testutil.ToFloat64(atlas.ConfigReloadsCounter.WithLabelValues("failure")); v != failures+1 {
+					t.Fatalf("expected failed reload to be counted")
+				}
+				if v := testutil.ToFloat64(atlas.ConfigLastReloadSuccessfulGauge); v != 0 {
+					t.Fatalf("expected last reload to be reported as failed, got %v", v)
+				}
+				return
+			}
+
+			if currentConfig() == old {
+				t.Fatalf("expected configuration to be replaced")
+			}
+			// request strategies can not be reloaded, so they are created again
+			if currentStrategy() == oldStrategy {
+				t.Fatalf("expected request strategy to be replaced")
+			}
+			if v := testutil.ToFloat64(atlas.ConfigReloadsCounter.WithLabelValues("success")); v != successes+1 {
+				t.Fatalf("expected successful reload to be counted")
+			}
+			if v := testutil.ToFloat64(atlas.ConfigLastReloadSuccessfulGauge); v != 1 {
+				t.Fatalf("expected last reload to be reported as successful, got %v", v)
+			}
+		})
+	}
+}
+
+func TestStartDiscovery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"results":[{"id":2001}]}`))
+	}))
+	defer srv.Close()
+
+	apiCfg := &config.Config{}
+	apiCfg.Atlas.APIURL = srv.URL
+	if err := atlas.InitClient(apiCfg); err != nil {
+		t.Fatal(err)
+	}
+
+	withRules, withoutRules := &config.Config{}, &config.Config{}
+	withRules.Discovery.Interval = time.Hour
+	withRules.Discovery.Rules = []config.DiscoveryRule{{Name: "anycast"}}
+	withoutRules.Discovery.Interval = time.Hour
+
+	tests := []struct {
+		name      string
+		previous  any
+		replay    bool
+		discovery *config.Config
+		started   bool
+		stopped   bool
+		ids       []string
+	}{
+		{
+			name:      "rules are discovered",
+			discovery: withRules,
+			started:   true,
+			stopped:   true,
+			ids:       []string{"1001", "2001"},
+		},
+		{
+			name:      "unchanged rules keep discovery",
+			previous:  withRules.Discovery,
+			discovery: withRules,
+			ids:       []string{"1001", "1999"},
+		},
+		{
+			name:      "removed rules stop discovery",
+			previous:  withRules.Discovery,
+			discovery: withoutRules,
+			stopped:   true,
+			ids:       []string{"1001"},
+		},
+		{
+			name:      "no discovery in replay mode",
+			replay:    true,
+			discovery: withRules,
+			ids:       []string{"1001", "1999"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &config.Config{Measurements: []config.Measurement{{ID: "1001"}}}
+			c.Discovery = tc.discovery.Discovery
+			c.Replay.Enabled = tc.replay
+			withState(t, c)
+
+			// measurement discovered before
+			registry.Set("discovery", []config.Measurement{{ID: "1999"}})
+			discoveryConfig = tc.previous
+			stopped := false
+			stopDiscovery = func() { stopped = true }
+
+			startDiscovery(context.Background(), c)
+
+			if stopped != tc.stopped {
+				t.Fatalf("expected discovery stopped %v, got %v", tc.stopped, stopped)
+			}
+
+			if tc.started {
+				deadline := time.Now().Add(5 * time.Second)
+				for !slices.Equal(registry.IDs(), tc.ids) && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+
+			if ids := registry.IDs(); !slices.Equal(ids, tc.ids) {
+				t.Fatalf("expected measurements %v, got %v", tc.ids, ids)
+			}
+		})
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(c *config.Config)
+		expected []string
+	}{
+		{
+			name:     "reloadable settings",
+			change:   func(c *config.Config) { c.Timeout = time.Minute; c.Measurements = []config.Measurement{{ID: "1001"}} },
+			expected: []string{},
+		},
+		{
+			name: "settings applied on start are sorted",
+			change: func(c *config.Config) {
+				c.Web.ListenAddress = ":9401"
+				c.Streaming.BufferSize = 10
+				c.Atlas.APIURL = "http://localhost"
+				c.Cache.TTL = time.Minute
+			},
+			expected: []string{"atlas", "cache", "streaming.buffer_size", "web"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			old := &config.Config{}
+			c := &config.Config{}
+			tc.change(c)
+
+			if names := restartRequired(old, c); !slices.Equal(names, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
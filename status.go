@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: LGPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/czerwonk/atlas_exporter/admin"
+	"github.com/czerwonk/atlas_exporter/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// status is the state of the exporter served by /status
+type status struct {
+	Version      string                   `json:"version"`
+	Mode         string                   `json:"mode"`
+	Ready        bool                     `json:"ready"`
+	Measurements []admin.MeasurementState `json:"measurements"`
+}
+
+func currentStatus() status {
+	cfg := currentConfig()
+	s := currentStrategy()
+
+	st := status{
+		Version:      version,
+		Mode:         mode(cfg),
+		Ready:        s != nil && s.IsHealthy(),
+		Measurements: make([]admin.MeasurementState, 0),
+	}
+
+	for _, id := range registry.IDs() {
+		st.Measurements = append(st.Measurements, admin.State(registry, s, id))
+	}
+
+	return st
+}
+
+func mode(cfg *config.Config) string {
+	switch {
+	case cfg.Replay.Enabled:
+		return "replay"
+	case cfg.Streaming.Enabled:
+		return "streaming"
+	default:
+		return "request"
+	}
+}
+
+func handleStatusRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(currentStatus()); err != nil {
+		log.Errorf("could not write status response: %v", err)
+	}
+}
+
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"dropped": formatDropped,
+}).Parse(`<html>
+<head><title>RIPE Atlas Exporter (Version {{.Status.Version}})</title></head>
+<body>
+<h1>RIPE Atlas Exporter</h1>
+<h2>Example</h2>
+<p>Metrics for measurement configured in configuration file:</p>
+<p><a href="{{.TelemetryPath}}">{{.Host}}{{.TelemetryPath}}</a></p>
+<p>Metrics for measurement with id 8809582:</p>
+<p><a href="{{.TelemetryPath}}?measurement_id=8809582">{{.Host}}{{.TelemetryPath}}?measurement_id=8809582</a></p>
+<h2>Status</h2>
+<p>Mode: {{.Status.Mode}}, ready: {{.Status.Ready}} (<a href="/status">JSON</a>)</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>ID</th><th>Source</th><th>Type</th><th>AF</th><th>Connected</th><th>Retry attempt</th><th>Last data</th><th>Probes</th><th>Dropped</th><th>Last error</th></tr>
+{{- range .Status.Measurements}}
+<tr>
+<td>{{.ID}}{{if .Paused}} (paused){{end}}</td>
+<td>{{.Source}}</td>
+<td>{{.Type}}</td>
+<td>{{if .AF}}{{.AF}}{{end}}</td>
+<td>{{.Connected}}</td>
+<td>{{.RetryAttempt}}</td>
+<td>{{with .LastData}}{{.Format "2006-01-02 15:04:05 MST"}}{{end}}</td>
+<td>{{.Probes}}</td>
+<td>{{dropped .Dropped}}</td>
+<td>{{with .LastError}}{{.Time.Format "2006-01-02 15:04:05 MST"}}: {{.Message}}{{end}}</td>
+</tr>
+{{- end}}
+</table>
+<h2>More information</h2>
+<p><a href="https://github.com/rjocoleman/atlas_exporter">github.com/rjocoleman/atlas_exporter</a></p>
+</body>
+</html>
+`))
+
+func handleIndexRequest(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Host          string
+		TelemetryPath string
+		Status        status
+	}{
+		Host:          r.Host,
+		TelemetryPath: currentConfig().Web.TelemetryPath,
+		Status:        currentStatus(),
+	}
+
+	if err := indexTemplate.Execute(w, data); err != nil {
+		log.Errorf("could not write index page: %v", err)
+	}
+}
+
+// formatDropped formats the number of results dropped by reason, e.g. "duplicate: 1, invalid: 3"
+func formatDropped(dropped map[string]int) string {
+	reasons := make([]string, 0, len(dropped))
+	for reason := range dropped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	parts := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		parts = append(parts, reason+": "+strconv.Itoa(dropped[reason]))
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -6,27 +6,29 @@ import (
 	"strconv"
 
 	"github.com/DNS-OARC/ripeatlas/measurement"
+	"github.com/czerwonk/atlas_exporter/exporter"
 	"github.com/czerwonk/atlas_exporter/probe"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-var (
-	labels      []string
+type tracerouteExporter struct {
+	id          string
+	probeLabels *exporter.ProbeLabels
 	successDesc *prometheus.Desc
 	hopDesc     *prometheus.Desc
 	rttDesc     *prometheus.Desc
-)
-
-func init() {
-	labels = []string{"measurement", "probe", "dst_addr", "dst_name", "asn", "ip_version", "protocol", "country_code", "lat", "long"}
-
-	successDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "success"), "Destination was reachable", labels, nil)
-	hopDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "hops"), "Number of hops", labels, nil)
-	rttDesc = prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "rtt"), "Round trip time in ms", labels, nil)
 }
 
-type tracerouteExporter struct {
-	id string
+func newTracerouteExporter(id string, probeLabels *exporter.ProbeLabels) *tracerouteExporter {
+	labels := append([]string{"measurement", "probe", "dst_addr", "dst_name", "ip_version", "protocol"}, probeLabels.Names()...)
+
+	return &tracerouteExporter{
+		id:          id,
+		probeLabels: probeLabels,
+		successDesc: prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "success"), "Destination was reachable", labels, nil),
+		hopDesc:     prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "hops"), "Number of hops", labels, nil),
+		rttDesc:     prometheus.NewDesc(prometheus.BuildFQName(ns, sub, "rtt"), "Round trip time in ms", labels, nil),
+	}
 }
 
 // Export exports a prometheus metric
@@ -36,27 +38,24 @@ func (m *tracerouteExporter) Export(res *measurement.Result, probe *probe.Probe,
 		strconv.Itoa(probe.ID),
 		res.DstAddr(),
 		res.DstName(),
-		strconv.Itoa(probe.ASNForIPVersion(res.Af())),
 		strconv.Itoa(res.Af()),
 		res.Proto(),
-		probe.CountryCode,
-		probe.Latitude(),
-		probe.Longitude(),
 	}
+	labelValues = append(labelValues, m.probeLabels.Values(probe, res.Af())...)
 
 	success, rtt := processLastHop(res)
 	hops := float64(len(res.TracerouteResults()))
-	ch <- prometheus.MustNewConstMetric(successDesc, prometheus.GaugeValue, success, labelValues...)
-	ch <- prometheus.MustNewConstMetric(hopDesc, prometheus.GaugeValue, hops, labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.successDesc, prometheus.GaugeValue, success, labelValues...)
+	ch <- prometheus.MustNewConstMetric(m.hopDesc, prometheus.GaugeValue, hops, labelValues...)
 
 	if rtt > 0 {
-		ch <- prometheus.MustNewConstMetric(rttDesc, prometheus.GaugeValue, rtt, labelValues...)
+		ch <- prometheus.MustNewConstMetric(m.rttDesc, prometheus.GaugeValue, rtt, labelValues...)
 	}
 }
 
 // Describe exports metric descriptions for Prometheus
 func (m *tracerouteExporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- successDesc
-	ch <- hopDesc
-	ch <- rttDesc
+	ch <- m.successDesc
+	ch <- m.hopDesc
+	ch <- m.rttDesc
 }
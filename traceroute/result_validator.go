@@ -12,5 +12,9 @@ type tracerouteResultValidator struct {
 
 // IsValid returns whether an result is valid or not (e.g. IPv6 measurement and Probe does not support IPv6)
 func (m *tracerouteResultValidator) IsValid(res *measurement.Result, probe *probe.Probe) bool {
-	return probe.ASNForIPVersion(res.Af()) > 0 && len(res.TracerouteResults()) > 1
+	if len(res.TracerouteResults()) <= 1 {
+		return false
+	}
+
+	return probe.Placeholder || probe.ASNForIPVersion(res.Af()) > 0
 }
@@ -14,20 +14,32 @@ const (
 )
 
 // NewMeasurement returns a new instance of `exorter.Measurement` for a traceroute measurement
-func NewMeasurement(id, ipVersion string, cfg *config.Config) *exporter.Measurement {
+func NewMeasurement(id, ipVersion string, s config.MeasurementSettings) *exporter.Measurement {
 	opts := []exporter.MeasurementOpt{
-		exporter.WithHistograms(newRttHistogram(id, ipVersion, cfg.HistogramBuckets.Traceroute.Rtt)),
+		exporter.WithHistograms(newRttHistogram(id, ipVersion, s.HistogramBuckets.Traceroute.Rtt)),
 	}
 
-	if cfg.FilterInvalidResults {
+	if s.FilterInvalidResults {
 		opts = append(opts, exporter.WithValidator(&tracerouteResultValidator{}))
 	}
 
-	if cfg.MaxResultAge > 0 {
-		opts = append(opts, exporter.WithMaxResultAge(cfg.MaxResultAge))
+	if s.MaxResultAge > 0 {
+		opts = append(opts, exporter.WithMaxResultAge(s.MaxResultAge))
 	}
 
-	return exporter.NewMeasurement(&tracerouteExporter{id}, opts...)
+	if len(s.Labels) > 0 {
+		opts = append(opts, exporter.WithLabels(s.Labels))
+	}
+
+	if s.Retention > 0 {
+		opts = append(opts, exporter.WithRetention(s.Retention))
+	}
+
+	if s.MaxProbes > 0 {
+		opts = append(opts, exporter.WithMaxProbes(s.MaxProbes))
+	}
+
+	return exporter.NewMeasurement(newTracerouteExporter(id, exporter.NewProbeLabels(s.LabelPolicy("traceroute"))), opts...)
 }
 
 func processLastHop(r *measurement.Result) (success float64, rtt float64) {